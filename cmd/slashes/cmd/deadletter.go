@@ -0,0 +1,51 @@
+package cmd
+
+import (
+	"encoding/json"
+	"os"
+
+	"github.com/HatsuneMiku3939/slashes/pkg/slack"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// deadLettersCmd represents the dead-letters command
+var deadLettersCmd = &cobra.Command{
+	Use:   "dead-letters",
+	Short: "dead-letters is a command for display the results which could not be delivered",
+	Long: `dead-letters is a command for display the results which could not be delivered.
+
+It prints the dead letters stored in the dead letter file as JSON Lines,
+one result per line in the stored order.`,
+
+	Run: deadLettersRun,
+}
+
+func deadLettersRun(cmd *cobra.Command, args []string) {
+	path := viper.GetString("slack.dead_letter_file")
+	if path == "" {
+		logrus.Fatal("dead letter file is not set")
+		return
+	}
+
+	letters, err := slack.NewFileDeadLetterStore(path).List()
+	if err != nil {
+		logrus.WithError(err).Fatal("failed to read dead letters")
+		return
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	for _, letter := range letters {
+		if err := encoder.Encode(letter); err != nil {
+			logrus.WithError(err).Fatal("failed to print dead letter")
+			return
+		}
+	}
+}
+
+func init() {
+	// add dead-letters command to slack command
+	slackCmd.AddCommand(deadLettersCmd)
+}
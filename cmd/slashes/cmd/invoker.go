@@ -0,0 +1,104 @@
+package cmd
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/HatsuneMiku3939/slashes/pkg/invoker"
+
+	"github.com/spf13/viper"
+)
+
+// newInvoker returns a new command invoker selected by the configuration
+func newInvoker(httpClient *http.Client) (invoker.Invoker, error) {
+	switch kind := viper.GetString("invoker"); kind {
+	case "exec":
+		limits, err := newLimits()
+		if err != nil {
+			return nil, err
+		}
+
+		return invoker.NewLimitedCmdInvoker(limits), nil
+	case "sandbox":
+		limits, err := newLimits()
+		if err != nil {
+			return nil, err
+		}
+
+		config := invoker.SandboxConfig{
+			Network:   viper.GetBool("sandbox.network"),
+			TmpfsSize: viper.GetString("sandbox.tmpfs_size"),
+		}
+		for _, spec := range viper.GetStringSlice("sandbox.binds") {
+			bind, err := invoker.ParseBindMount(spec)
+			if err != nil {
+				return nil, err
+			}
+			config.Binds = append(config.Binds, bind)
+		}
+
+		return invoker.NewSandboxInvoker(config, limits), nil
+	case "ssh":
+		return invoker.NewSSHInvoker(invoker.SSHConfig{
+			Addr:           viper.GetString("ssh.addr"),
+			User:           viper.GetString("ssh.user"),
+			KeyFile:        viper.GetString("ssh.key"),
+			KnownHostsFile: viper.GetString("ssh.known_hosts"),
+		})
+	case "webhook":
+		url := viper.GetString("webhook.url")
+		if url == "" {
+			return nil, fmt.Errorf("webhook invoker requires the webhook URL")
+		}
+
+		return invoker.NewWebhookInvoker(httpClient, url, viper.GetString("webhook.secret")), nil
+	case "container":
+		image := viper.GetString("container.image")
+		if image == "" {
+			return nil, fmt.Errorf("container invoker requires the container image")
+		}
+
+		stopTimeout, err := time.ParseDuration(viper.GetString("container.stop_timeout"))
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse container stop timeout: %w", err)
+		}
+
+		return invoker.NewContainerInvoker(invoker.ContainerConfig{
+			Runtime:     viper.GetString("container.runtime"),
+			Image:       image,
+			Volumes:     viper.GetStringSlice("container.volumes"),
+			Env:         viper.GetStringSlice("container.env"),
+			Network:     viper.GetString("container.network"),
+			Memory:      viper.GetString("container.memory"),
+			CPUs:        viper.GetString("container.cpus"),
+			PidsLimit:   viper.GetInt64("container.pids_limit"),
+			StopTimeout: stopTimeout,
+		}), nil
+	case "wasm":
+		return invoker.NewWasmInvoker(invoker.WasmConfig{
+			Env:         viper.GetStringSlice("wasm.env"),
+			MemoryLimit: viper.GetUint64("wasm.memory_limit"),
+		})
+	default:
+		return nil, fmt.Errorf("unknown invoker: %s", kind)
+	}
+}
+
+// newLimits returns the resource limits for the child processes
+func newLimits() (invoker.Limits, error) {
+	cpuTime, err := time.ParseDuration(viper.GetString("limits.cpu_time"))
+	if err != nil {
+		return invoker.Limits{}, fmt.Errorf("failed to parse CPU time limit: %w", err)
+	}
+
+	return invoker.Limits{
+		CPUTime:      cpuTime,
+		AddressSpace: viper.GetUint64("limits.address_space"),
+		OpenFiles:    viper.GetUint64("limits.open_files"),
+		Processes:    viper.GetUint64("limits.processes"),
+		Cgroup:       viper.GetString("limits.cgroup"),
+		MemoryMax:    viper.GetString("limits.memory_max"),
+		CPUMax:       viper.GetString("limits.cpu_max"),
+	}, nil
+}
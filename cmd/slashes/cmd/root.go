@@ -4,7 +4,9 @@ import (
 	"os"
 	"strings"
 
+	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
 )
 
@@ -32,21 +34,124 @@ func init() {
 	viper.SetEnvPrefix("slashes")
 	viper.AutomaticEnv()
 
+	// read the config file before running the commands
+	cobra.OnInitialize(readConfig)
+
 	// set root command flags
+	rootCmd.PersistentFlags().String("config", "", "path to the config file, which accepts all the settings and the argument schema")
 	rootCmd.PersistentFlags().StringP("command", "c", "", "absolute path to the command to be executed")
 	rootCmd.PersistentFlags().StringP("timeout", "t", "5s", "timeout for the command to be executed")
 	rootCmd.PersistentFlags().StringP("port", "p", ":8080", "port to listen for slash command requests")
+	rootCmd.PersistentFlags().String("argument-mode", "shellwords", "how to pass the command text to the command, one of shellwords, raw, split, stdin and json")
+
+	// set text format flags
+	rootCmd.PersistentFlags().String("text-users", "raw", "how to decode the user references in the command text, one of raw, id and name")
+	rootCmd.PersistentFlags().String("text-channels", "raw", "how to decode the channel references in the command text, one of raw, id and name")
+	rootCmd.PersistentFlags().String("text-usergroups", "raw", "how to decode the usergroup references in the command text, one of raw, id and name")
+	rootCmd.PersistentFlags().String("text-links", "raw", "how to decode the links in the command text, one of raw, id (URL) and name (label)")
+
+	// set invoker flags
+	rootCmd.PersistentFlags().String("invoker", "exec", "how to invoke the command, one of exec, sandbox, ssh, webhook, container and wasm")
+
+	// set resource limit flags
+	rootCmd.PersistentFlags().String("limit-cpu-time", "0s", "maximum CPU time of the command, rounded up to whole seconds, 0 means unlimited")
+	rootCmd.PersistentFlags().Uint64("limit-address-space", 0, "maximum virtual memory size of the command in bytes, 0 means unlimited")
+	rootCmd.PersistentFlags().Uint64("limit-open-files", 0, "maximum number of open files of the command, 0 means unlimited")
+	rootCmd.PersistentFlags().Uint64("limit-processes", 0, "maximum number of processes of the command user, 0 means unlimited")
+	rootCmd.PersistentFlags().String("limit-cgroup", "", "cgroup v2 directory to create a cgroup for each command in")
+	rootCmd.PersistentFlags().String("limit-memory-max", "", "memory.max of the cgroup for each command (e.g. 512M)")
+	rootCmd.PersistentFlags().String("limit-cpu-max", "", "cpu.max of the cgroup for each command (e.g. \"50000 100000\")")
+
+	// set sandbox flags
+	rootCmd.PersistentFlags().Bool("sandbox-network", false, "keep the host network in the sandbox")
+	rootCmd.PersistentFlags().StringSlice("sandbox-bind", nil, "host path to bind-mount into the sandbox, in the form of source[:target][:ro|:rw]")
+	rootCmd.PersistentFlags().String("sandbox-tmpfs-size", "", "size of the private tmpfs mounted on /tmp in the sandbox (e.g. 64m)")
+
+	// set ssh flags
+	rootCmd.PersistentFlags().String("ssh-addr", "", "address of the remote host to run the command on, in the form of host:port")
+	rootCmd.PersistentFlags().String("ssh-user", "", "user name on the remote host")
+	rootCmd.PersistentFlags().String("ssh-key", "", "path to the private key for the remote host")
+	rootCmd.PersistentFlags().String("ssh-known-hosts", "", "path to the known_hosts file for verifying the remote host")
+
+	// set webhook flags
+	rootCmd.PersistentFlags().String("webhook-url", "", "URL of the webhook to post the command to")
+	rootCmd.PersistentFlags().String("webhook-secret", "", "secret for signing the webhook requests")
+
+	// set container flags
+	rootCmd.PersistentFlags().String("container-runtime", "docker", "container runtime CLI to run the container with, such as docker, podman and nerdctl")
+	rootCmd.PersistentFlags().String("container-image", "", "image of the container to run the command in")
+	rootCmd.PersistentFlags().StringSlice("container-volume", nil, "volume to mount into the container, in the form of the runtime --volume flag")
+	rootCmd.PersistentFlags().StringSlice("container-env", nil, "environment variable of the container, in the form of KEY=VALUE or KEY")
+	rootCmd.PersistentFlags().String("container-network", "", "network of the container")
+	rootCmd.PersistentFlags().String("container-memory", "", "memory limit of the container (e.g. 512m)")
+	rootCmd.PersistentFlags().String("container-cpus", "", "number of CPUs of the container (e.g. 0.5)")
+	rootCmd.PersistentFlags().Int64("container-pids-limit", 0, "maximum number of processes in the container, 0 means unlimited")
+	rootCmd.PersistentFlags().String("container-stop-timeout", "10s", "grace period before the container is killed on timeout")
+
+	// set wasm flags
+	rootCmd.PersistentFlags().StringSlice("wasm-env", nil, "name of the environment variable passed to the WASI module")
+	rootCmd.PersistentFlags().Uint64("wasm-memory-limit", 0, "maximum memory of the WASI module in bytes up to 4GiB, rounded up to 64KiB pages, 0 means 4GiB")
 
 	// bind root command flags to viper
-	if err := viper.BindPFlag("command", rootCmd.PersistentFlags().Lookup("command")); err != nil {
-		panic(err)
+	bindFlags(rootCmd.PersistentFlags(), map[string]string{
+		"config":                 "config",
+		"command":                "command",
+		"timeout":                "timeout",
+		"port":                   "port",
+		"argument_mode":          "argument-mode",
+		"text_format.users":      "text-users",
+		"text_format.channels":   "text-channels",
+		"text_format.usergroups": "text-usergroups",
+		"text_format.links":      "text-links",
+		"limits.cpu_time":        "limit-cpu-time",
+		"limits.address_space":   "limit-address-space",
+		"limits.open_files":      "limit-open-files",
+		"limits.processes":       "limit-processes",
+		"limits.cgroup":          "limit-cgroup",
+		"limits.memory_max":      "limit-memory-max",
+		"limits.cpu_max":         "limit-cpu-max",
+		"invoker":                "invoker",
+		"sandbox.network":        "sandbox-network",
+		"sandbox.binds":          "sandbox-bind",
+		"sandbox.tmpfs_size":     "sandbox-tmpfs-size",
+		"ssh.addr":               "ssh-addr",
+		"ssh.user":               "ssh-user",
+		"ssh.key":                "ssh-key",
+		"ssh.known_hosts":        "ssh-known-hosts",
+		"webhook.url":            "webhook-url",
+		"webhook.secret":         "webhook-secret",
+		"container.runtime":      "container-runtime",
+		"container.image":        "container-image",
+		"container.volumes":      "container-volume",
+		"container.env":          "container-env",
+		"container.network":      "container-network",
+		"container.memory":       "container-memory",
+		"container.cpus":         "container-cpus",
+		"container.pids_limit":   "container-pids-limit",
+		"container.stop_timeout": "container-stop-timeout",
+		"wasm.env":               "wasm-env",
+		"wasm.memory_limit":      "wasm-memory-limit",
+	})
+}
+
+// readConfig reads the config file if given
+func readConfig() {
+	file := viper.GetString("config")
+	if file == "" {
+		return
 	}
 
-	if err := viper.BindPFlag("timeout", rootCmd.PersistentFlags().Lookup("timeout")); err != nil {
-		panic(err)
+	viper.SetConfigFile(file)
+	if err := viper.ReadInConfig(); err != nil {
+		logrus.WithError(err).Fatal("failed to read config file")
 	}
+}
 
-	if err := viper.BindPFlag("port", rootCmd.PersistentFlags().Lookup("port")); err != nil {
-		panic(err)
+// bindFlags binds the flags to viper, the keys of the map are viper keys and the values are flag names
+func bindFlags(flags *pflag.FlagSet, keys map[string]string) {
+	for key, name := range keys {
+		if err := viper.BindPFlag(key, flags.Lookup(name)); err != nil {
+			panic(err)
+		}
 	}
 }
@@ -1,13 +1,14 @@
 package cmd
 
 import (
+	"context"
 	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
+	"text/template"
 	"time"
 
-	"github.com/HatsuneMiku3939/slashes/pkg/invoker"
 	"github.com/HatsuneMiku3939/slashes/pkg/slack"
 	"github.com/HatsuneMiku3939/slashes/server"
 
@@ -32,6 +33,9 @@ func slackRun(cmd *cobra.Command, args []string) {
 	port := viper.GetString("port")
 	// slack command flags
 	path := viper.GetString("slack.url")
+	interactivityPath := viper.GetString("slack.interactivity_url")
+	optionsPath := viper.GetString("slack.options_url")
+	eventsPath := viper.GetString("slack.events_url")
 	verifyToken := viper.GetString("slack.verify_token")
 
 	// create server
@@ -44,13 +48,200 @@ func slackRun(cmd *cobra.Command, args []string) {
 	logger := logrus.New()
 	logger.SetLevel(logrus.InfoLevel)
 	HTTPClient := &http.Client{}
-	cmdInvoker := invoker.NewCmdInvoker()
+	cmdInvoker, err := newInvoker(HTTPClient)
+	if err != nil {
+		logrus.WithError(err).Fatal("failed to create invoker")
+		return
+	}
 
-	srv := server.New(port, map[string]server.Handler{
-		path: slack.New(
-			cmdInvoker, HTTPClient, logger,
-			command, timeoutDuration, verifyToken),
-	})
+	handler := slack.New(
+		cmdInvoker, HTTPClient, logger,
+		command, timeoutDuration, verifyToken)
+	if handler.ArgumentMode, err = slack.ParseArgumentMode(viper.GetString("argument_mode")); err != nil {
+		logrus.WithError(err).Fatal("failed to parse argument mode")
+		return
+	}
+	handler.TextFormat = slack.TextFormat{
+		Users:      slack.ReferenceFormat(viper.GetString("text_format.users")),
+		Channels:   slack.ReferenceFormat(viper.GetString("text_format.channels")),
+		Usergroups: slack.ReferenceFormat(viper.GetString("text_format.usergroups")),
+		Links:      slack.ReferenceFormat(viper.GetString("text_format.links")),
+	}
+	if err := handler.TextFormat.Validate(); err != nil {
+		logrus.WithError(err).Fatal("invalid text format")
+		return
+	}
+	if handler.MessageFormat, err = slack.ParseMessageFormat(viper.GetString("slack.message_format")); err != nil {
+		logrus.WithError(err).Fatal("failed to parse message format")
+		return
+	}
+	if handler.OutputProtocol, err = slack.ParseOutputProtocol(viper.GetString("slack.output_protocol")); err != nil {
+		logrus.WithError(err).Fatal("failed to parse output protocol")
+		return
+	}
+	if handler.StartResponseType, err = slack.ParseResponseType(viper.GetString("slack.start_response_type")); err != nil {
+		logrus.WithError(err).Fatal("failed to parse start response type")
+		return
+	}
+	if handler.FinishResponseType, err = slack.ParseResponseType(viper.GetString("slack.finish_response_type")); err != nil {
+		logrus.WithError(err).Fatal("failed to parse finish response type")
+		return
+	}
+	handler.PublicFlag = viper.GetString("slack.public_flag")
+	handler.ReplaceOriginal = viper.GetBool("slack.replace_original")
+	handler.DeleteOriginal = viper.GetBool("slack.delete_original")
+	handler.SuppressStart = viper.GetBool("slack.suppress_start")
+	if handler.SyncBudget, err = time.ParseDuration(viper.GetString("slack.sync_budget")); err != nil {
+		logrus.WithError(err).Fatal("failed to parse sync budget")
+		return
+	}
+	if handler.SyncBudget >= 3*time.Second {
+		logrus.WithField("budget", handler.SyncBudget).Fatal("sync budget must be shorter than 3s")
+		return
+	}
+	handler.BotToken = viper.GetString("slack.bot_token")
+	handler.SigningSecret = viper.GetString("slack.signing_secret")
+	handler.APIURL = viper.GetString("slack.api_url")
+	if handler.ProgressInterval, err = time.ParseDuration(viper.GetString("slack.progress_interval")); err != nil {
+		logrus.WithError(err).Fatal("failed to parse progress interval")
+		return
+	}
+	if handler.BotToken == "" && timeoutDuration >= 30*time.Minute {
+		logrus.WithField("timeout", timeoutDuration).Warn("the response URL expires in 30m, the results of the longer commands can not be delivered without the bot token")
+	}
+	handler.Retry.MaxAttempts = viper.GetInt("slack.retry.max_attempts")
+	if handler.Retry.InitialBackoff, err = time.ParseDuration(viper.GetString("slack.retry.initial_backoff")); err != nil {
+		logrus.WithError(err).Fatal("failed to parse retry initial backoff")
+		return
+	}
+	if handler.Retry.MaxBackoff, err = time.ParseDuration(viper.GetString("slack.retry.max_backoff")); err != nil {
+		logrus.WithError(err).Fatal("failed to parse retry max backoff")
+		return
+	}
+	if path := viper.GetString("slack.dead_letter_file"); path != "" {
+		handler.DeadLetters = slack.NewFileDeadLetterStore(path)
+	}
+	handler.ApprovalRequired = viper.GetBool("slack.approval_required")
+	handler.Approvers = viper.GetStringSlice("slack.approvers")
+	handler.ThreadResult = viper.GetBool("slack.thread_result")
+	handler.AuditChannels = viper.GetStringSlice("slack.audit_channels")
+	if handler.BotToken == "" && (handler.ThreadResult || len(handler.AuditChannels) > 0) {
+		logrus.Fatal("thread result and audit channels require the bot token")
+		return
+	}
+	for event, t := range map[string]**template.Template{
+		"start":   &handler.Templates.Start,
+		"finish":  &handler.Templates.Finish,
+		"error":   &handler.Templates.Error,
+		"timeout": &handler.Templates.Timeout,
+	} {
+		text := viper.GetString("slack.templates." + event)
+		if text == "" {
+			continue
+		}
+		if *t, err = slack.ParseMessageTemplate(event, text); err != nil {
+			logrus.WithError(err).WithField("event", event).Fatal("failed to parse message template")
+			return
+		}
+	}
+	for _, name := range viper.GetStringSlice("slack.buttons") {
+		button, err := slack.ParseButton(name)
+		if err != nil {
+			logrus.WithError(err).Fatal("failed to parse button")
+			return
+		}
+		handler.Buttons = append(handler.Buttons, button)
+	}
+	if logURL := viper.GetString("slack.log_url"); logURL != "" {
+		if handler.LogURL, err = slack.ParseLogURL(logURL); err != nil {
+			logrus.WithError(err).Fatal("failed to parse log URL")
+			return
+		}
+	}
+	if viper.IsSet("schema") {
+		schema := &slack.Schema{}
+		if err := viper.UnmarshalKey("schema", schema); err != nil {
+			logrus.WithError(err).Fatal("failed to read argument schema")
+			return
+		}
+		if err := schema.Validate(); err != nil {
+			logrus.WithError(err).Fatal("invalid argument schema")
+			return
+		}
+		handler.Schema = schema
+	}
+	if viper.IsSet("argv_template") {
+		if handler.ArgvTemplate, err = slack.ParseArgvTemplate(viper.GetStringSlice("argv_template")); err != nil {
+			logrus.WithError(err).Fatal("failed to parse argv template")
+			return
+		}
+	}
+	handler.ModalForm = viper.GetBool("slack.modal_form")
+	if handler.ModalForm && (handler.BotToken == "" || handler.Schema == nil || interactivityPath == "") {
+		logrus.Fatal("modal form requires the bot token, the schema and the interactivity URL")
+		return
+	}
+
+	handlers := map[string]server.Handler{
+		path: handler,
+	}
+	var interactionHandler *slack.InteractionHandler
+	if interactivityPath != "" {
+		interactionHandler = slack.NewInteractionHandler(handler, logger)
+		for id, command := range viper.GetStringMapString("slack.interaction_commands") {
+			interactionHandler.Commands[id] = command
+		}
+		handlers[interactivityPath] = interactionHandler
+	}
+	var optionsHandler *slack.OptionsHandler
+	if optionsPath != "" {
+		optionsHandler = slack.NewOptionsHandler(handler, logger)
+		if optionsHandler.Timeout, err = time.ParseDuration(viper.GetString("slack.options_timeout")); err != nil {
+			logrus.WithError(err).Fatal("failed to parse options timeout")
+			return
+		}
+		if optionsHandler.CacheTTL, err = time.ParseDuration(viper.GetString("slack.options_cache_ttl")); err != nil {
+			logrus.WithError(err).Fatal("failed to parse options cache ttl")
+			return
+		}
+		handlers[optionsPath] = optionsHandler
+	}
+	var eventsHandler *slack.EventsHandler
+	if eventsPath != "" {
+		if handler.BotToken == "" {
+			logrus.Fatal("events require the bot token to reply")
+			return
+		}
+		eventsHandler = slack.NewEventsHandler(handler, handler.SigningSecret, logger)
+		eventsHandler.Name = viper.GetString("slack.events_command")
+		handlers[eventsPath] = eventsHandler
+	}
+
+	// receive the requests through the websocket instead of listening
+	if viper.GetBool("slack.socket_mode") {
+		appToken := viper.GetString("slack.app_token")
+		if appToken == "" {
+			logrus.Fatal("socket mode requires the app-level token")
+			return
+		}
+		socket := slack.NewSocketMode(appToken, handler, logger)
+		socket.Interactions = interactionHandler
+		socket.Options = optionsHandler
+		socket.Events = eventsHandler
+		runSocketMode(socket)
+		return
+	}
+
+	if eventsHandler != nil && eventsHandler.SigningSecret == "" {
+		logrus.Fatal("events require the signing secret to verify the requests")
+		return
+	}
+	if (interactionHandler != nil || optionsHandler != nil) && handler.SigningSecret == "" && verifyToken == "" {
+		logrus.Fatal("interactions and options require the signing secret or the verification token to verify the requests")
+		return
+	}
+
+	srv := server.New(port, handlers)
 
 	// start server in background
 	errs := make(chan error, 1)
@@ -77,19 +268,122 @@ func slackRun(cmd *cobra.Command, args []string) {
 	}
 }
 
+// runSocketMode runs the Socket Mode connection until a signal is received
+func runSocketMode(socket *slack.SocketMode) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// connect in background
+	errs := make(chan error, 1)
+	go func() {
+		errs <- socket.Run(ctx)
+	}()
+
+	// wait signal
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
+
+	select {
+	case err := <-errs:
+		logrus.WithError(err).Fatal("socket mode connection failed")
+	case s := <-sig:
+		logrus.WithField("signal", s).Info("received signal")
+	}
+
+	// disconnect
+	cancel()
+	if err := <-errs; err != nil {
+		logrus.WithError(err).Error("failed to disconnect socket mode")
+	}
+}
+
 func init() {
 	// set slack command flags
 	slackCmd.Flags().StringP("url", "u", "/slack", "URL path to listen for slash command requests")
 	slackCmd.Flags().StringP("verify-token", "v", "", "slack verification token")
+	slackCmd.Flags().String("message-format", "code", "format of the messages, one of code and blocks")
+	slackCmd.Flags().String("output-protocol", "plain", "how to interpret the output of the command, one of plain, json (slack message payload) and marker (payload after a \""+slack.OutputMarker+"\" line)")
+	slackCmd.Flags().String("start-response-type", "ephemeral", "response type of the start notice, one of ephemeral and in_channel")
+	slackCmd.Flags().String("finish-response-type", "ephemeral", "response type of the result, one of ephemeral and in_channel")
+	slackCmd.Flags().String("public-flag", "", "flag users add at the beginning or the end of the text to post the result in the channel (e.g. --public)")
+	slackCmd.Flags().Bool("replace-original", false, "replace the start notice with the result")
+	slackCmd.Flags().Bool("delete-original", false, "delete the start notice before the result is posted")
+	slackCmd.Flags().String("template-start", "", "template of the start notice, executed with the job metadata")
+	slackCmd.Flags().String("template-finish", "", "template of the result of the command exited with any exit code")
+	slackCmd.Flags().String("template-error", "", "template of the result of the command failed to be invoked, canceled or killed")
+	slackCmd.Flags().String("template-timeout", "", "template of the result of the command timed out")
+	slackCmd.Flags().String("sync-budget", "0s", "how long to wait for the command to respond with the result directly, must be shorter than 3s, 0 means always asynchronous")
+	slackCmd.Flags().Bool("suppress-start", false, "do not post the start notice, for the fast commands")
+	slackCmd.Flags().String("bot-token", "", "slack bot token, the in_channel messages are posted by the Web API and updated in place with the progress and the result, the ephemeral ones still use the response URL")
+	slackCmd.Flags().String("api-url", "", "base URL of the slack Web API, empty means the default")
+	slackCmd.Flags().String("progress-interval", "0s", "how often the message posted by the Web API is updated with the elapsed time, 0 means no progress")
+	slackCmd.Flags().Bool("thread-result", false, "post the in_channel result as a reply in the thread of the message posted by the Web API, requires the bot token")
+	slackCmd.Flags().StringSlice("audit-channel", nil, "channel the results are mirrored to by the Web API, requires the bot token")
+	slackCmd.Flags().Int("retry-max-attempts", slack.DefaultRetryPolicy.MaxAttempts, "maximum number of attempts to post a message failed by the transient errors, including the first one")
+	slackCmd.Flags().String("retry-initial-backoff", slack.DefaultRetryPolicy.InitialBackoff.String(), "wait before the first retry, doubled for each retry with jitter")
+	slackCmd.Flags().String("retry-max-backoff", slack.DefaultRetryPolicy.MaxBackoff.String(), "maximum wait between the retries")
+	slackCmd.PersistentFlags().String("dead-letter-file", "", "path to the JSON Lines file storing the results which could not be delivered")
+	slackCmd.Flags().String("interactivity-url", "", "URL path to listen for interaction requests of the buttons, menus, modals and shortcuts (e.g. /slack/interactivity), empty means disabled, requires the signing secret or the verification token")
+	slackCmd.Flags().StringToString("interaction-command", nil, "command invoked by the action ID of the block actions, or the callback ID of the view submissions and the shortcuts, in the form of id=path")
+	slackCmd.Flags().String("events-url", "", "URL path to listen for the Events API requests of the app mentions and the direct messages, empty means disabled, requires the bot token")
+	slackCmd.Flags().String("signing-secret", "", "slack signing secret verifying the requests of the Events API, the interactions and the options, the verification token is used for the interactions and the options if not set")
+	slackCmd.Flags().String("events-command", "", "name of the command the mentions and the direct messages start with (e.g. deploy), empty means the whole text is the arguments")
+	slackCmd.Flags().Bool("socket-mode", false, "receive the slash commands, the interactions and the events through the Socket Mode websocket instead of listening for HTTP requests")
+	slackCmd.Flags().String("app-token", "", "slack app-level token (xapp-) opening the Socket Mode connection")
+	slackCmd.Flags().String("options-url", "", "URL path to listen for option requests of the select menus in the modal form (e.g. /slack/options), empty means disabled, requires the signing secret or the verification token")
+	slackCmd.Flags().String("options-timeout", slack.DefaultOptionsTimeout.String(), "timeout of the options command of the select menus, which runs on the local host instead of the invoker of the slash commands")
+	slackCmd.Flags().String("options-cache-ttl", slack.DefaultOptionsCacheTTL.String(), "duration the options of the select menus are reused, 0 means no cache")
+	slackCmd.Flags().Bool("modal-form", false, "open the modal form generated from the schema when the command is sent without the text, requires the bot token")
+	slackCmd.Flags().Bool("approval-required", false, "hold the jobs until approved by the approve button")
+	slackCmd.Flags().StringSlice("approver", nil, "ID of the user who can approve the jobs, anyone but the requester if not set, the approvers can also cancel and rerun the jobs of the others")
+	slackCmd.Flags().StringSlice("button", nil, "button attached to the messages in the blocks format, one of rerun, cancel and log")
+	slackCmd.Flags().String("log-url", "", "template of the URL of the full log opened by the log button (e.g. https://logs.example.com/jobs/{{.JobID}})")
 
 	// bind slack command flags to viper
-	if err := viper.BindPFlag("slack.url", slackCmd.Flags().Lookup("url")); err != nil {
-		panic(err)
-	}
+	bindFlags(slackCmd.Flags(), map[string]string{
+		"slack.url":                   "url",
+		"slack.verify_token":          "verify-token",
+		"slack.interactivity_url":     "interactivity-url",
+		"slack.interaction_commands":  "interaction-command",
+		"slack.approval_required":     "approval-required",
+		"slack.approvers":             "approver",
+		"slack.modal_form":            "modal-form",
+		"slack.events_url":            "events-url",
+		"slack.signing_secret":        "signing-secret",
+		"slack.events_command":        "events-command",
+		"slack.socket_mode":           "socket-mode",
+		"slack.app_token":             "app-token",
+		"slack.options_url":           "options-url",
+		"slack.options_timeout":       "options-timeout",
+		"slack.options_cache_ttl":     "options-cache-ttl",
+		"slack.message_format":        "message-format",
+		"slack.buttons":               "button",
+		"slack.output_protocol":       "output-protocol",
+		"slack.start_response_type":   "start-response-type",
+		"slack.finish_response_type":  "finish-response-type",
+		"slack.public_flag":           "public-flag",
+		"slack.replace_original":      "replace-original",
+		"slack.delete_original":       "delete-original",
+		"slack.templates.start":       "template-start",
+		"slack.templates.finish":      "template-finish",
+		"slack.templates.error":       "template-error",
+		"slack.templates.timeout":     "template-timeout",
+		"slack.suppress_start":        "suppress-start",
+		"slack.sync_budget":           "sync-budget",
+		"slack.log_url":               "log-url",
+		"slack.bot_token":             "bot-token",
+		"slack.api_url":               "api-url",
+		"slack.progress_interval":     "progress-interval",
+		"slack.thread_result":         "thread-result",
+		"slack.audit_channels":        "audit-channel",
+		"slack.retry.max_attempts":    "retry-max-attempts",
+		"slack.retry.initial_backoff": "retry-initial-backoff",
+		"slack.retry.max_backoff":     "retry-max-backoff",
+	})
 
-	if err := viper.BindPFlag("slack.verify_token", slackCmd.Flags().Lookup("verify-token")); err != nil {
-		panic(err)
-	}
+	bindFlags(slackCmd.PersistentFlags(), map[string]string{
+		"slack.dead_letter_file": "dead-letter-file",
+	})
 
 	// add slack command to root command
 	rootCmd.AddCommand(slackCmd)
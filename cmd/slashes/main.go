@@ -2,8 +2,12 @@ package main
 
 import (
 	"github.com/HatsuneMiku3939/slashes/cmd/slashes/cmd"
+	"github.com/HatsuneMiku3939/slashes/pkg/invoker"
 )
 
 func main() {
+	// run as the sandbox helper if the process is re-executed by the sandbox invoker
+	invoker.SandboxInit()
+
 	cmd.Execute()
 }
@@ -0,0 +1,184 @@
+package invoker
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// defaultContainerRuntime is the container runtime CLI used when none is configured
+	defaultContainerRuntime = "docker"
+	// containerStopMargin is the additional time given to the stop command over the grace period
+	containerStopMargin = 5 * time.Second
+	// containerRemoveInterval is the interval of removing the container which could not be stopped
+	containerRemoveInterval = 500 * time.Millisecond
+)
+
+// ContainerConfig is the configuration of the container running the command.
+type ContainerConfig struct {
+	// Runtime is the container runtime CLI compatible with docker, such as docker, podman and nerdctl
+	Runtime string
+	// Image is the image of the container
+	Image string
+	// Volumes is the volumes mounted into the container, in the form of the runtime --volume flag
+	Volumes []string
+	// Env is the environment variables of the container, in the form of KEY=VALUE or KEY
+	Env []string
+	// Network is the network of the container, empty means the runtime default
+	Network string
+	// Memory is the memory limit of the container (e.g. "512m")
+	Memory string
+	// CPUs is the number of CPUs of the container (e.g. "0.5")
+	CPUs string
+	// PidsLimit is the maximum number of processes in the container, zero means unlimited
+	PidsLimit int64
+	// StopTimeout is the grace period before the container is killed on timeout
+	StopTimeout time.Duration
+	// ExtraArgs is the additional flags passed to the run command
+	ExtraArgs []string
+}
+
+// ContainerInvoker is an Invoker implementation which runs the command in a container
+// through a container runtime CLI.
+type ContainerInvoker struct {
+	// Config is the configuration of the container
+	Config ContainerConfig
+}
+
+// NewContainerInvoker returns a new Container Invoker instance.
+func NewContainerInvoker(config ContainerConfig) Invoker {
+	if config.Runtime == "" {
+		config.Runtime = defaultContainerRuntime
+	}
+
+	return &ContainerInvoker{Config: config}
+}
+
+// Invoke invokes the command in a new container and returns the exit code with console outputs.
+func (i *ContainerInvoker) Invoke(ctx context.Context, command string, args ...string) (int, string, error) {
+	name, err := containerName()
+	if err != nil {
+		return -1, "", err
+	}
+
+	// the container is not stopped by killing the runtime CLI, so the context is handled by stopping the container
+	stdin, hasStdin := StdinFrom(ctx)
+	cmd := exec.Command(i.Config.Runtime, i.runArgs(name, hasStdin, command, args)...)
+	if hasStdin {
+		cmd.Stdin = strings.NewReader(stdin)
+	}
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+	if err := cmd.Start(); err != nil {
+		return -1, "", err
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- cmd.Wait()
+	}()
+
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		if err := i.stop(name); err != nil {
+			// the container may not exist yet while the image is pulled or the container is created,
+			// the runtime would still start it after the runtime CLI is killed
+			i.remove(name, done)
+			return -1, out.String(), ctx.Err()
+		}
+		<-done
+		return -1, out.String(), ctx.Err()
+	}
+
+	var exitErr *exec.ExitError
+	if err != nil && !errors.As(err, &exitErr) {
+		return -1, out.String(), err
+	}
+
+	// return the exit code of the container and console outputs
+	return cmd.ProcessState.ExitCode(), out.String(), err
+}
+
+// runArgs returns the arguments of the run command.
+func (i *ContainerInvoker) runArgs(name string, interactive bool, command string, args []string) []string {
+	runArgs := []string{"run", "--rm", "--name=" + name}
+	if interactive {
+		runArgs = append(runArgs, "--interactive")
+	}
+	for _, volume := range i.Config.Volumes {
+		runArgs = append(runArgs, "--volume="+volume)
+	}
+	for _, env := range i.Config.Env {
+		runArgs = append(runArgs, "--env="+env)
+	}
+	if i.Config.Network != "" {
+		runArgs = append(runArgs, "--network="+i.Config.Network)
+	}
+	if i.Config.Memory != "" {
+		runArgs = append(runArgs, "--memory="+i.Config.Memory)
+	}
+	if i.Config.CPUs != "" {
+		runArgs = append(runArgs, "--cpus="+i.Config.CPUs)
+	}
+	if i.Config.PidsLimit > 0 {
+		runArgs = append(runArgs, "--pids-limit="+strconv.FormatInt(i.Config.PidsLimit, 10))
+	}
+	runArgs = append(runArgs, i.Config.ExtraArgs...)
+
+	runArgs = append(runArgs, i.Config.Image, command)
+	return append(runArgs, args...)
+}
+
+// stop stops the container, the runtime kills it after the grace period.
+func (i *ContainerInvoker) stop(name string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), i.Config.StopTimeout+containerStopMargin)
+	defer cancel()
+
+	seconds := strconv.Itoa(int(i.Config.StopTimeout.Seconds()))
+	out, err := exec.CommandContext(ctx, i.Config.Runtime, "stop", "--time="+seconds, name).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%w: %s", err, out)
+	}
+
+	return nil
+}
+
+// remove removes the container forcibly until the run command exits and its result is received, so the container created after the timeout
+// is removed as soon as it appears. The attached run command exits only when the container is gone or could not be
+// created.
+func (i *ContainerInvoker) remove(name string, done <-chan error) {
+	ticker := time.NewTicker(containerRemoveInterval)
+	defer ticker.Stop()
+
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), containerStopMargin)
+		_ = exec.CommandContext(ctx, i.Config.Runtime, "rm", "--force", name).Run()
+		cancel()
+
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// containerName returns a unique name of the container.
+func containerName() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return "slashes-" + hex.EncodeToString(b), nil
+}
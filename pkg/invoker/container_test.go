@@ -0,0 +1,174 @@
+package invoker
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+// fakeRuntime is a container runtime CLI stand-in, which runs the command on the host
+// and records the invocations to the log file.
+const fakeRuntime = `#!/bin/sh
+echo "$@" >> %[1]s/log
+case "$1" in
+run)
+	shift
+	while [ $# -gt 0 ]; do
+		case "$1" in
+		--name=*) name=${1#--name=}; shift ;;
+		-*) shift ;;
+		*) break ;;
+		esac
+	done
+	shift
+	exec 3<&0
+	# the image pull or the container creation taking time
+	[ -n "$FAKE_RUNTIME_CREATE_DELAY" ] && sleep "$FAKE_RUNTIME_CREATE_DELAY"
+	"$@" <&3 &
+	echo $! > %[1]s/$name.pid
+	wait $!
+	;;
+stop|rm)
+	pid=$(cat %[1]s/$3.pid 2>/dev/null) || { echo "no such container: $3" >&2; exit 1; }
+	kill "$pid"
+	;;
+esac
+`
+
+// ContainerInvokerTestSuite is a test suite for ContainerInvoker
+type ContainerInvokerTestSuite struct {
+	suite.Suite
+
+	dir    string
+	config ContainerConfig
+}
+
+// SetupTest creates the fake container runtime.
+func (suite *ContainerInvokerTestSuite) SetupTest() {
+	suite.dir = suite.T().TempDir()
+	runtime := filepath.Join(suite.dir, "runtime")
+	require.NoError(suite.T(), os.WriteFile(runtime, []byte(fmt.Sprintf(fakeRuntime, suite.dir)), 0o700))
+
+	suite.config = ContainerConfig{
+		Runtime:   runtime,
+		Image:     "alpine:3",
+		Volumes:   []string{"/data:/data:ro"},
+		Env:       []string{"ENV=prod"},
+		Memory:    "64m",
+		PidsLimit: 16,
+	}
+}
+
+// log returns the invocations of the fake container runtime.
+func (suite *ContainerInvokerTestSuite) log() []string {
+	log, err := os.ReadFile(filepath.Join(suite.dir, "log"))
+	require.NoError(suite.T(), err)
+
+	return strings.Split(strings.TrimSpace(string(log)), "\n")
+}
+
+// TestInvokeSuccess tests the success case of invoking a command in a container
+func (suite *ContainerInvokerTestSuite) TestInvokeSuccess() {
+	ctx := context.Background()
+	invoker := NewContainerInvoker(suite.config)
+	exitCode, output, err := invoker.Invoke(ctx, "echo", "hello world")
+
+	// assert
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), 0, exitCode)
+	assert.Equal(suite.T(), "hello world\n", output)
+
+	log := suite.log()
+	assert.Len(suite.T(), log, 1)
+	assert.Regexp(suite.T(), `^run --rm --name=slashes-[0-9a-f]{16} --volume=/data:/data:ro --env=ENV=prod --memory=64m --pids-limit=16 alpine:3 echo hello world$`, log[0])
+}
+
+// TestInvokeStdin tests the success case of invoking a command with standard input in a container
+func (suite *ContainerInvokerTestSuite) TestInvokeStdin() {
+	ctx := WithStdin(context.Background(), "don't forget")
+	invoker := NewContainerInvoker(suite.config)
+	exitCode, output, err := invoker.Invoke(ctx, "cat")
+
+	// assert
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), 0, exitCode)
+	assert.Equal(suite.T(), "don't forget", output)
+	assert.Contains(suite.T(), suite.log()[0], " --interactive ")
+}
+
+// TestInvokeFailureExitCode tests the failure case of a command exiting with non-zero code in a container
+func (suite *ContainerInvokerTestSuite) TestInvokeFailureExitCode() {
+	ctx := context.Background()
+	invoker := NewContainerInvoker(suite.config)
+	exitCode, output, err := invoker.Invoke(ctx, "sh", "-c", "echo failed; exit 3")
+
+	// assert
+	assert.Error(suite.T(), err)
+	assert.Equal(suite.T(), 3, exitCode)
+	assert.Equal(suite.T(), "failed\n", output)
+}
+
+// TestInvokeFailureRuntime tests the failure case of a container runtime which does not exist
+func (suite *ContainerInvokerTestSuite) TestInvokeFailureRuntime() {
+	suite.config.Runtime = filepath.Join(suite.dir, "non-existent-runtime")
+
+	ctx := context.Background()
+	invoker := NewContainerInvoker(suite.config)
+	exitCode, _, err := invoker.Invoke(ctx, "echo", "hello world")
+
+	// assert
+	assert.Error(suite.T(), err)
+	assert.Equal(suite.T(), -1, exitCode)
+}
+
+// TestInvokeFailureTimeout tests the failure case of a command that times out, the container is stopped
+func (suite *ContainerInvokerTestSuite) TestInvokeFailureTimeout() {
+	ctx, cancelFunc := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancelFunc()
+	invoker := NewContainerInvoker(suite.config)
+	exitCode, _, err := invoker.Invoke(ctx, "sleep", "10")
+
+	// assert
+	assert.ErrorIs(suite.T(), err, context.DeadlineExceeded)
+	assert.Equal(suite.T(), -1, exitCode)
+
+	log := suite.log()
+	assert.Len(suite.T(), log, 2)
+	assert.Regexp(suite.T(), `^stop --time=0 slashes-[0-9a-f]{16}$`, log[1])
+}
+
+// TestInvokeFailureTimeoutBeforeCreate tests the failure case of a command that times out before the container is
+// created, the container is removed once it is created
+func (suite *ContainerInvokerTestSuite) TestInvokeFailureTimeoutBeforeCreate() {
+	suite.T().Setenv("FAKE_RUNTIME_CREATE_DELAY", "0.3")
+
+	ctx, cancelFunc := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancelFunc()
+	invoker := NewContainerInvoker(suite.config)
+	startedAt := time.Now()
+	exitCode, _, err := invoker.Invoke(ctx, "sleep", "10")
+
+	// assert
+	assert.ErrorIs(suite.T(), err, context.DeadlineExceeded)
+	assert.Equal(suite.T(), -1, exitCode)
+	assert.Less(suite.T(), time.Since(startedAt), 5*time.Second)
+
+	log := suite.log()
+	require.GreaterOrEqual(suite.T(), len(log), 3)
+	assert.Regexp(suite.T(), `^stop --time=0 slashes-[0-9a-f]{16}$`, log[1])
+	for _, line := range log[2:] {
+		assert.Regexp(suite.T(), `^rm --force slashes-[0-9a-f]{16}$`, line)
+	}
+}
+
+func TestContainerInvokerTestSuite(t *testing.T) {
+	suite.Run(t, new(ContainerInvokerTestSuite))
+}
@@ -0,0 +1,45 @@
+package invoker
+
+import (
+	"context"
+)
+
+// SlackContext is the Slack context of the invocation, which is passed to the invokers through context.Context.
+type SlackContext struct {
+	TeamID      string `json:"team_id"`
+	TeamDomain  string `json:"team_domain"`
+	ChannelID   string `json:"channel_id"`
+	ChannelName string `json:"channel_name"`
+	UserID      string `json:"user_id"`
+	UserName    string `json:"user_name"`
+	Command     string `json:"command"`
+	Text        string `json:"text"`
+}
+
+// slackContextKey is the context key of SlackContext
+type slackContextKey struct{}
+
+// WithSlackContext returns a copy of the context carrying the Slack context.
+func WithSlackContext(ctx context.Context, slackContext SlackContext) context.Context {
+	return context.WithValue(ctx, slackContextKey{}, slackContext)
+}
+
+// SlackContextFrom returns the Slack context carried by the context.
+func SlackContextFrom(ctx context.Context) (SlackContext, bool) {
+	slackContext, ok := ctx.Value(slackContextKey{}).(SlackContext)
+	return slackContext, ok
+}
+
+// stdinKey is the context key of the standard input
+type stdinKey struct{}
+
+// WithStdin returns a copy of the context carrying the standard input of the command.
+func WithStdin(ctx context.Context, stdin string) context.Context {
+	return context.WithValue(ctx, stdinKey{}, stdin)
+}
+
+// StdinFrom returns the standard input of the command carried by the context.
+func StdinFrom(ctx context.Context) (string, bool) {
+	stdin, ok := ctx.Value(stdinKey{}).(string)
+	return stdin, ok
+}
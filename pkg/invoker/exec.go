@@ -1,12 +1,17 @@
 package invoker
 
 import (
+	"bytes"
 	"context"
+	"os"
 	"os/exec"
+	"strings"
 )
 
 // CmdInvoker is a Command Invoker implementation.
 type CmdInvoker struct {
+	// Limits is the resource limits applied to the child processes, nil means unlimited
+	Limits *Limits
 }
 
 // New returns a new Command Invoker instance.
@@ -14,17 +19,66 @@ func NewCmdInvoker() Invoker {
 	return &CmdInvoker{}
 }
 
+// NewLimitedCmdInvoker returns a new Command Invoker instance which applies the resource limits to the child processes.
+// The limits are applied by re-executing the current executable, so SandboxInit must be called
+// at the beginning of the main function of the program.
+func NewLimitedCmdInvoker(limits Limits) Invoker {
+	return &CmdInvoker{Limits: &limits}
+}
+
 // Invoke invokes the command in a child process and returns the exit code with console outputs.
 func (i *CmdInvoker) Invoke(ctx context.Context, command string, args ...string) (int, string, error) {
-	// create a command
+	// create a command, the limited one is executed by the limits helper
 	cmd := exec.CommandContext(ctx, command, args...)
+	if i.Limits != nil && !i.Limits.IsZero() {
+		var err error
+		if cmd, err = limitedCommand(ctx, command, args...); err != nil {
+			return -1, "", err
+		}
+	}
+	if stdin, ok := StdinFrom(ctx); ok {
+		cmd.Stdin = strings.NewReader(stdin)
+	}
 
 	// run the command
-	out, err := cmd.CombinedOutput()
+	return run(cmd, i.Limits)
+}
+
+// run runs the command with the resource limits and returns the exit code with console outputs.
+// The command must be executed by a helper which applies the limits before executing the actual command.
+func run(cmd *exec.Cmd, limits *Limits) (int, string, error) {
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+
+	// pass the resource limits to the helper
+	var release func(*os.ProcessState) string
+	if limits != nil && !limits.IsZero() {
+		env, r, err := limits.prepare()
+		if err != nil {
+			return -1, "", err
+		}
+		release = r
+		cmd.Env = append(cmd.Environ(), env)
+	}
+
+	if err := cmd.Start(); err != nil {
+		if release != nil {
+			release(nil)
+		}
+		return cmd.ProcessState.ExitCode(), out.String(), err
+	}
+
+	err := cmd.Wait()
+	if release != nil {
+		if resource := release(cmd.ProcessState); resource != "" {
+			return cmd.ProcessState.ExitCode(), out.String(), &LimitExceededError{Resource: resource, Err: err}
+		}
+	}
 	if err != nil {
-		return cmd.ProcessState.ExitCode(), string(out), err
+		return cmd.ProcessState.ExitCode(), out.String(), err
 	}
 
 	// return the exit code and console outputs
-	return cmd.ProcessState.ExitCode(), string(out), nil
+	return cmd.ProcessState.ExitCode(), out.String(), nil
 }
@@ -51,6 +51,18 @@ func (suite *CmdInvokerTestSuite) TestInvokeFailureTimeout() {
 	assert.Equal(suite.T(), "hello world\n", output)
 }
 
+// TestInvokeStdin tests the success case of invoking a command with standard input
+func (suite *CmdInvokerTestSuite) TestInvokeStdin() {
+	ctx := WithStdin(context.Background(), "don't forget")
+	invoker := NewCmdInvoker()
+	exitCode, output, err := invoker.Invoke(ctx, "cat")
+
+	// assert
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), 0, exitCode)
+	assert.Equal(suite.T(), "don't forget", output)
+}
+
 func TestCmdInvokerTestSuite(t *testing.T) {
 	suite.Run(t, new(CmdInvokerTestSuite))
 }
@@ -0,0 +1,110 @@
+package invoker
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+)
+
+// Request is the request passed to the command handler functions.
+type Request struct {
+	// Command is the name of the command
+	Command string
+	// Args is the parsed arguments
+	Args []string
+	// Slack is the Slack context of the invocation, nil if the command is not invoked from Slack
+	Slack *SlackContext
+	// Stdin is the standard input of the command, it is empty if no standard input is given
+	Stdin io.Reader
+	// Output is the console output of the command, the written content precedes the output of the response
+	// and is kept when the command times out
+	Output io.Writer
+}
+
+// Response is the response returned by the command handler functions.
+type Response struct {
+	// ExitCode is the exit code of the command
+	ExitCode int
+	// Output is the console output of the command
+	Output string
+}
+
+// HandlerFunc is a Go function handling a command in-process.
+type HandlerFunc func(ctx context.Context, req Request) (Response, error)
+
+// FuncInvoker is an Invoker implementation which dispatches the commands to registered Go functions
+// instead of executables. It follows the semantics of CmdInvoker: a handler returning an error
+// exits with non-zero code, and a handler still running after the context is done is abandoned.
+type FuncInvoker struct {
+	mu       sync.RWMutex
+	handlers map[string]HandlerFunc
+}
+
+// NewFuncInvoker returns a new Func Invoker instance without handlers.
+func NewFuncInvoker() *FuncInvoker {
+	return &FuncInvoker{
+		handlers: make(map[string]HandlerFunc),
+	}
+}
+
+// Register registers the handler function for the command, replacing the existing one.
+func (i *FuncInvoker) Register(command string, handler HandlerFunc) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	i.handlers[command] = handler
+}
+
+// Invoke calls the handler function of the command and returns the exit code with console outputs.
+func (i *FuncInvoker) Invoke(ctx context.Context, command string, args ...string) (int, string, error) {
+	i.mu.RLock()
+	handler, ok := i.handlers[command]
+	i.mu.RUnlock()
+	if !ok {
+		return -1, "", fmt.Errorf("no handler registered for command: %s", command)
+	}
+
+	out := &syncBuffer{}
+	stdin, _ := StdinFrom(ctx)
+	req := Request{Command: command, Args: args, Stdin: strings.NewReader(stdin), Output: out}
+	if slackContext, ok := SlackContextFrom(ctx); ok {
+		req.Slack = &slackContext
+	}
+
+	type result struct {
+		res Response
+		err error
+	}
+	done := make(chan result, 1)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				done <- result{res: Response{ExitCode: -1}, err: fmt.Errorf("panic: %v", r)}
+			}
+		}()
+
+		res, err := handler(ctx, req)
+		done <- result{res: res, err: err}
+	}()
+
+	var r result
+	select {
+	case r = <-done:
+	case <-ctx.Done():
+		return -1, out.String(), ctx.Err()
+	}
+
+	output := out.String() + r.res.Output
+	switch {
+	case r.err != nil && r.res.ExitCode == 0:
+		return 1, output, r.err
+	case r.err != nil:
+		return r.res.ExitCode, output, r.err
+	case r.res.ExitCode != 0:
+		return r.res.ExitCode, output, fmt.Errorf("exit status %d", r.res.ExitCode)
+	default:
+		return 0, output, nil
+	}
+}
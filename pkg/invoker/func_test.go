@@ -0,0 +1,139 @@
+package invoker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+// FuncInvokerTestSuite is a test suite for FuncInvoker
+type FuncInvokerTestSuite struct {
+	suite.Suite
+
+	invoker *FuncInvoker
+}
+
+// SetupTest registers the handlers.
+func (suite *FuncInvokerTestSuite) SetupTest() {
+	suite.invoker = NewFuncInvoker()
+	suite.invoker.Register("echo", func(ctx context.Context, req Request) (Response, error) {
+		user := ""
+		if req.Slack != nil {
+			user = req.Slack.UserName + ": "
+		}
+		return Response{Output: user + strings.Join(req.Args, " ") + "\n"}, nil
+	})
+	suite.invoker.Register("cat", func(ctx context.Context, req Request) (Response, error) {
+		stdin, err := io.ReadAll(req.Stdin)
+		return Response{Output: string(stdin)}, err
+	})
+	suite.invoker.Register("fail", func(ctx context.Context, req Request) (Response, error) {
+		fmt.Fprintln(req.Output, "failing")
+		return Response{}, errors.New("unexpected error")
+	})
+	suite.invoker.Register("exit", func(ctx context.Context, req Request) (Response, error) {
+		return Response{ExitCode: 3, Output: "exit 3"}, nil
+	})
+	suite.invoker.Register("panic", func(ctx context.Context, req Request) (Response, error) {
+		panic("oops")
+	})
+	suite.invoker.Register("sleep", func(ctx context.Context, req Request) (Response, error) {
+		fmt.Fprintln(req.Output, "hello world")
+		time.Sleep(time.Second)
+		return Response{Output: "goodbye world\n"}, nil
+	})
+}
+
+// TestInvokeSuccess tests the success case of invoking a handler
+func (suite *FuncInvokerTestSuite) TestInvokeSuccess() {
+	ctx := WithSlackContext(context.Background(), SlackContext{UserName: "miku"})
+	exitCode, output, err := suite.invoker.Invoke(ctx, "echo", "hello", "world")
+
+	// assert
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), 0, exitCode)
+	assert.Equal(suite.T(), "miku: hello world\n", output)
+}
+
+// TestInvokeStdin tests the success case of invoking a handler with standard input
+func (suite *FuncInvokerTestSuite) TestInvokeStdin() {
+	// without standard input
+	ctx := context.Background()
+	exitCode, output, err := suite.invoker.Invoke(ctx, "cat")
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), 0, exitCode)
+	assert.Equal(suite.T(), "", output)
+
+	// with standard input
+	ctx = WithStdin(ctx, "don't forget")
+	exitCode, output, err = suite.invoker.Invoke(ctx, "cat")
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), 0, exitCode)
+	assert.Equal(suite.T(), "don't forget", output)
+}
+
+// TestInvokeFailure tests the failure case of invoking a command without handler
+func (suite *FuncInvokerTestSuite) TestInvokeFailure() {
+	ctx := context.Background()
+	exitCode, output, err := suite.invoker.Invoke(ctx, "non-existent-command")
+
+	// assert
+	assert.Error(suite.T(), err)
+	assert.Equal(suite.T(), -1, exitCode)
+	assert.Equal(suite.T(), "", output)
+}
+
+// TestInvokeFailureError tests the failure case of a handler returning an error
+func (suite *FuncInvokerTestSuite) TestInvokeFailureError() {
+	ctx := context.Background()
+	exitCode, output, err := suite.invoker.Invoke(ctx, "fail")
+
+	// assert
+	assert.EqualError(suite.T(), err, "unexpected error")
+	assert.Equal(suite.T(), 1, exitCode)
+	assert.Equal(suite.T(), "failing\n", output)
+}
+
+// TestInvokeFailureExitCode tests the failure case of a handler returning non-zero exit code
+func (suite *FuncInvokerTestSuite) TestInvokeFailureExitCode() {
+	ctx := context.Background()
+	exitCode, output, err := suite.invoker.Invoke(ctx, "exit")
+
+	// assert
+	assert.Error(suite.T(), err)
+	assert.Equal(suite.T(), 3, exitCode)
+	assert.Equal(suite.T(), "exit 3", output)
+}
+
+// TestInvokeFailurePanic tests the failure case of a panicking handler
+func (suite *FuncInvokerTestSuite) TestInvokeFailurePanic() {
+	ctx := context.Background()
+	exitCode, _, err := suite.invoker.Invoke(ctx, "panic")
+
+	// assert
+	assert.EqualError(suite.T(), err, "panic: oops")
+	assert.Equal(suite.T(), -1, exitCode)
+}
+
+// TestInvokeFailureTimeout tests the failure case of a handler that times out
+func (suite *FuncInvokerTestSuite) TestInvokeFailureTimeout() {
+	ctx, cancelFunc := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancelFunc()
+	exitCode, output, err := suite.invoker.Invoke(ctx, "sleep")
+
+	// assert
+	assert.ErrorIs(suite.T(), err, context.DeadlineExceeded)
+	assert.Equal(suite.T(), -1, exitCode)
+	assert.Equal(suite.T(), "hello world\n", output)
+}
+
+func TestFuncInvokerTestSuite(t *testing.T) {
+	suite.Run(t, new(FuncInvokerTestSuite))
+}
@@ -0,0 +1,49 @@
+package invoker
+
+import (
+	"fmt"
+	"time"
+)
+
+// Limits is the resource limits applied to the child processes spawned by CmdInvoker.
+// Zero values mean unlimited.
+type Limits struct {
+	// CPUTime is the maximum CPU time of the process (RLIMIT_CPU), rounded up to whole seconds
+	CPUTime time.Duration
+	// AddressSpace is the maximum size of the virtual memory in bytes (RLIMIT_AS)
+	AddressSpace uint64
+	// OpenFiles is the maximum number of open file descriptors (RLIMIT_NOFILE)
+	OpenFiles uint64
+	// Processes is the maximum number of processes of the user (RLIMIT_NPROC)
+	Processes uint64
+
+	// Cgroup is the cgroup v2 directory under which a cgroup is created for each process
+	Cgroup string
+	// MemoryMax is the value written to memory.max of the cgroup (e.g. "512M")
+	MemoryMax string
+	// CPUMax is the value written to cpu.max of the cgroup (e.g. "50000 100000")
+	CPUMax string
+}
+
+// LimitExceededError is the error returned when the command was terminated by a resource limit.
+type LimitExceededError struct {
+	// Resource is the name of the exceeded resource
+	Resource string
+	// Err is the error returned by the command
+	Err error
+}
+
+// Error implements error.
+func (e *LimitExceededError) Error() string {
+	return fmt.Sprintf("%s limit exceeded: %v", e.Resource, e.Err)
+}
+
+// Unwrap returns the error returned by the command.
+func (e *LimitExceededError) Unwrap() error {
+	return e.Err
+}
+
+// IsZero reports whether no limit is configured.
+func (l *Limits) IsZero() bool {
+	return *l == Limits{}
+}
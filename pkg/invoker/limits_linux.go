@@ -0,0 +1,262 @@
+package invoker
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// resourceCPUTime is the resource name reported when the CPU time limit is exceeded
+	resourceCPUTime = "CPU time"
+	// resourceMemory is the resource name reported when the cgroup memory limit is exceeded
+	resourceMemory = "memory"
+
+	// limitsInitArg is the argv[0] of the limits helper process
+	limitsInitArg = "slashes-limits-init"
+	// limitsConfigEnv is the environment variable passing the limits to the helper process
+	limitsConfigEnv = "_SLASHES_LIMITS_CONFIG"
+)
+
+// limitsConfig is the limits passed to the helper process.
+type limitsConfig struct {
+	// Limits is the resource limits
+	Limits Limits `json:"limits"`
+	// Cgroup is the cgroup created for the process, empty means no cgroup
+	Cgroup string `json:"cgroup"`
+}
+
+// limitedCommand returns the command re-executing the current executable as the limits helper.
+// The helper applies the limits to itself and then executes the command, so the command and
+// its children never run without the limits.
+func limitedCommand(ctx context.Context, command string, args ...string) (*exec.Cmd, error) {
+	// resolve the command in the parent to fail early as exec.Cmd does
+	path, err := exec.LookPath(command)
+	if err != nil {
+		return nil, err
+	}
+
+	cmd := exec.CommandContext(ctx, "/proc/self/exe", append([]string{path, command}, args...)...)
+	cmd.Args[0] = limitsInitArg
+
+	return cmd, nil
+}
+
+// prepare creates the cgroup of the process and returns the environment variable passing the limits
+// to the helper process. It also returns a function that must be called after the process exited,
+// which releases the resources and reports the name of the exceeded limit if any.
+func (l *Limits) prepare() (string, func(*os.ProcessState) string, error) {
+	cgroup, err := l.createCgroup()
+	if err != nil {
+		return "", nil, err
+	}
+
+	config, err := json.Marshal(&limitsConfig{Limits: *l, Cgroup: cgroup})
+	if err != nil {
+		if cgroup != "" {
+			_ = os.Remove(cgroup)
+		}
+		return "", nil, err
+	}
+
+	return limitsConfigEnv + "=" + string(config), func(state *os.ProcessState) string {
+		oomKilled := false
+		if cgroup != "" {
+			oomKilled = cgroupOOMKilled(cgroup)
+			if err := os.Remove(cgroup); err != nil {
+				logrus.WithError(err).WithField("cgroup", cgroup).Warn("Failed to remove cgroup")
+			}
+		}
+
+		switch {
+		case l.cpuTimeExceeded(state):
+			return resourceCPUTime
+		case oomKilled:
+			return resourceMemory
+		default:
+			return ""
+		}
+	}, nil
+}
+
+// createCgroup creates a cgroup with the limits for the process.
+// It returns the path of the created cgroup, or an empty string if cgroup v2 is not available.
+func (l *Limits) createCgroup() (string, error) {
+	if l.Cgroup == "" {
+		return "", nil
+	}
+
+	// cgroup v2 exposes cgroup.controllers in every cgroup directory
+	if _, err := os.Stat(filepath.Join(l.Cgroup, "cgroup.controllers")); err != nil {
+		logrus.WithError(err).WithField("cgroup", l.Cgroup).Warn("cgroup v2 is not available, skip cgroup limits")
+		return "", nil
+	}
+
+	cgroup, err := os.MkdirTemp(l.Cgroup, "slashes-")
+	if err != nil {
+		return "", fmt.Errorf("failed to create cgroup: %w", err)
+	}
+
+	files := []struct {
+		name  string
+		value string
+	}{
+		{"memory.max", l.MemoryMax},
+		{"cpu.max", l.CPUMax},
+	}
+	for _, f := range files {
+		if f.value == "" {
+			continue
+		}
+
+		if err := os.WriteFile(filepath.Join(cgroup, f.name), []byte(f.value), 0o644); err != nil {
+			// the cgroup is still empty, so it can be removed
+			_ = os.Remove(cgroup)
+			return "", fmt.Errorf("failed to write %s: %w", f.name, err)
+		}
+	}
+
+	return cgroup, nil
+}
+
+// limitsInit applies the limits to the current process and executes the command.
+func limitsInit(path string, argv []string) error {
+	config, err := readLimitsConfig()
+	if err != nil {
+		return err
+	}
+	if err := config.enterCgroup(); err != nil {
+		return err
+	}
+
+	env := os.Environ()
+	if err := config.setRlimits(); err != nil {
+		return err
+	}
+
+	return syscall.Exec(path, argv, env)
+}
+
+// readLimitsConfig reads the limits passed by the parent process, it returns nil if no limit is passed.
+func readLimitsConfig() (*limitsConfig, error) {
+	value, ok := os.LookupEnv(limitsConfigEnv)
+	if !ok {
+		return nil, nil
+	}
+
+	var config limitsConfig
+	if err := json.Unmarshal([]byte(value), &config); err != nil {
+		return nil, fmt.Errorf("malformed limits configuration: %w", err)
+	}
+	if err := os.Unsetenv(limitsConfigEnv); err != nil {
+		return nil, err
+	}
+
+	return &config, nil
+}
+
+// enterCgroup moves the current process into the cgroup created by the parent process.
+func (c *limitsConfig) enterCgroup() error {
+	if c == nil || c.Cgroup == "" {
+		return nil
+	}
+
+	// 0 means the writing process
+	if err := os.WriteFile(filepath.Join(c.Cgroup, "cgroup.procs"), []byte("0"), 0o644); err != nil {
+		return fmt.Errorf("failed to enter cgroup: %w", err)
+	}
+
+	return nil
+}
+
+// setRlimits sets the resource limits of the current process.
+// It must be called right before the command is executed, since the Go runtime may fail
+// to allocate memory beyond the address space limit.
+func (c *limitsConfig) setRlimits() error {
+	if c == nil {
+		return nil
+	}
+	l := &c.Limits
+
+	// the address space limit comes last
+	rlimits := []struct {
+		resource int
+		value    uint64
+	}{
+		{unix.RLIMIT_NOFILE, l.OpenFiles},
+		{unix.RLIMIT_NPROC, l.Processes},
+		{unix.RLIMIT_AS, l.AddressSpace},
+	}
+	if l.CPUTime > 0 {
+		// the soft limit sends SIGXCPU, the hard limit one second later sends SIGKILL. The limit is in whole seconds,
+		// so the fraction is rounded up not to kill the command before the configured time.
+		seconds := uint64((l.CPUTime + time.Second - 1) / time.Second)
+
+		if err := syscall.Setrlimit(unix.RLIMIT_CPU, &syscall.Rlimit{Cur: seconds, Max: seconds + 1}); err != nil {
+			return fmt.Errorf("failed to set CPU time limit: %w", err)
+		}
+	}
+	for _, r := range rlimits {
+		if r.value == 0 {
+			continue
+		}
+
+		// syscall.Setrlimit keeps the Go runtime from restoring the original open files limit on exec
+		if err := syscall.Setrlimit(r.resource, &syscall.Rlimit{Cur: r.value, Max: r.value}); err != nil {
+			return fmt.Errorf("failed to set resource limit %d: %w", r.resource, err)
+		}
+	}
+
+	return nil
+}
+
+// cpuTimeExceeded reports whether the process was terminated by the CPU time limit.
+func (l *Limits) cpuTimeExceeded(state *os.ProcessState) bool {
+	if l.CPUTime <= 0 || state == nil {
+		return false
+	}
+
+	status, ok := state.Sys().(syscall.WaitStatus)
+	if !ok || !status.Signaled() {
+		return false
+	}
+
+	switch status.Signal() {
+	case syscall.SIGXCPU:
+		return true
+	case syscall.SIGKILL:
+		// SIGKILL is also sent by the hard limit
+		return state.UserTime()+state.SystemTime() >= l.CPUTime
+	default:
+		return false
+	}
+}
+
+// cgroupOOMKilled reports whether a process in the cgroup was killed by the OOM killer.
+func cgroupOOMKilled(cgroup string) bool {
+	f, err := os.Open(filepath.Join(cgroup, "memory.events"))
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 2 && fields[0] == "oom_kill" {
+			return fields[1] != "0"
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,97 @@
+package invoker
+
+import (
+	"context"
+	"errors"
+	"os/exec"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+// LimitsTestSuite is a test suite for the resource limits of CmdInvoker
+type LimitsTestSuite struct {
+	suite.Suite
+}
+
+// TestInvokeWithinLimits tests the success case of invoking a command within the limits
+func (suite *LimitsTestSuite) TestInvokeWithinLimits() {
+	ctx := context.Background()
+	invoker := NewLimitedCmdInvoker(Limits{
+		CPUTime:   10 * time.Second,
+		OpenFiles: 64,
+		// cgroup v2 is not available in the directory, so it is skipped
+		Cgroup:    suite.T().TempDir(),
+		MemoryMax: "64M",
+	})
+	exitCode, output, err := invoker.Invoke(ctx, "echo", "hello world")
+
+	// assert
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), 0, exitCode)
+	assert.Equal(suite.T(), "hello world\n", output)
+}
+
+// TestInvokeCPUTimeExceeded tests the failure case of invoking a command that exceeds the CPU time limit
+func (suite *LimitsTestSuite) TestInvokeCPUTimeExceeded() {
+	ctx, cancelFunc := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancelFunc()
+	invoker := NewLimitedCmdInvoker(Limits{CPUTime: time.Second})
+	exitCode, _, err := invoker.Invoke(ctx, "bash", "-c", "while :; do :; done")
+
+	// assert
+	var limitErr *LimitExceededError
+	assert.True(suite.T(), errors.As(err, &limitErr))
+	assert.Equal(suite.T(), "CPU time", limitErr.Resource)
+	assert.Equal(suite.T(), -1, exitCode)
+	assert.NoError(suite.T(), ctx.Err())
+}
+
+// TestInvokeCPUTimeRoundedUp tests rounding up the CPU time limit to whole seconds
+func (suite *LimitsTestSuite) TestInvokeCPUTimeRoundedUp() {
+	ctx := context.Background()
+	for cpuTime, expected := range map[time.Duration]string{
+		time.Millisecond:        "1\n",
+		time.Second:             "1\n",
+		1500 * time.Millisecond: "2\n",
+	} {
+		invoker := NewLimitedCmdInvoker(Limits{CPUTime: cpuTime})
+		exitCode, output, err := invoker.Invoke(ctx, "sh", "-c", "ulimit -t")
+
+		// assert
+		assert.NoError(suite.T(), err)
+		assert.Equal(suite.T(), 0, exitCode)
+		assert.Equal(suite.T(), expected, output, cpuTime)
+	}
+}
+
+// TestInvokeLimitsFromStart tests the limits are already applied when the command starts
+func (suite *LimitsTestSuite) TestInvokeLimitsFromStart() {
+	ctx := context.Background()
+	invoker := NewLimitedCmdInvoker(Limits{OpenFiles: 64})
+	for i := 0; i < 50; i++ {
+		exitCode, output, err := invoker.Invoke(ctx, "sh", "-c", "ulimit -n")
+
+		// assert
+		assert.NoError(suite.T(), err)
+		assert.Equal(suite.T(), 0, exitCode)
+		assert.Equal(suite.T(), "64\n", output)
+	}
+}
+
+// TestInvokeNotFound tests the failure case of invoking a command that does not exist with the limits
+func (suite *LimitsTestSuite) TestInvokeNotFound() {
+	ctx := context.Background()
+	invoker := NewLimitedCmdInvoker(Limits{OpenFiles: 64})
+	exitCode, _, err := invoker.Invoke(ctx, "slashes-not-found")
+
+	// assert
+	assert.ErrorIs(suite.T(), err, exec.ErrNotFound)
+	assert.Equal(suite.T(), -1, exitCode)
+}
+
+func TestLimitsTestSuite(t *testing.T) {
+	suite.Run(t, new(LimitsTestSuite))
+}
@@ -0,0 +1,23 @@
+//go:build !linux
+
+package invoker
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+)
+
+// errLimitsNotSupported is the error returned because resource limits are only supported on Linux.
+var errLimitsNotSupported = errors.New("resource limits are not supported on this platform")
+
+// limitedCommand returns an error because resource limits are only supported on Linux.
+func limitedCommand(ctx context.Context, command string, args ...string) (*exec.Cmd, error) {
+	return nil, errLimitsNotSupported
+}
+
+// prepare returns an error because resource limits are only supported on Linux.
+func (l *Limits) prepare() (string, func(*os.ProcessState) string, error) {
+	return "", nil, errLimitsNotSupported
+}
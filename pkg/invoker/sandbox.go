@@ -0,0 +1,78 @@
+package invoker
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// BindMount is a host path bind-mounted into the sandbox.
+type BindMount struct {
+	// Source is the path on the host
+	Source string `json:"source"`
+	// Target is the path in the sandbox, it must exist on the host root filesystem
+	Target string `json:"target"`
+	// ReadOnly mounts the path as read-only
+	ReadOnly bool `json:"readOnly"`
+}
+
+// SandboxConfig is the configuration of the sandbox.
+type SandboxConfig struct {
+	// Network keeps the host network in the sandbox, the network is disabled by default
+	Network bool `json:"network"`
+	// Binds is the host paths bind-mounted into the sandbox
+	Binds []BindMount `json:"binds"`
+	// TmpfsSize is the size of the private tmpfs mounted on /tmp (e.g. "64m"), empty means the kernel default
+	TmpfsSize string `json:"tmpfsSize"`
+}
+
+// SandboxInvoker is an Invoker implementation which runs the command in new Linux namespaces.
+// The command sees a read-only view of the host root filesystem with a private tmpfs on /tmp
+// and the configured bind mounts. Only PATH and LANG of the host environment are passed to the command.
+//
+// The sandbox is set up by re-executing the current executable, so SandboxInit must be called
+// at the beginning of the main function of the program.
+type SandboxInvoker struct {
+	// Config is the configuration of the sandbox
+	Config SandboxConfig
+	// Limits is the resource limits applied to the sandboxed processes, nil means unlimited
+	Limits *Limits
+}
+
+// NewSandboxInvoker returns a new Sandbox Invoker instance.
+func NewSandboxInvoker(config SandboxConfig, limits Limits) Invoker {
+	return &SandboxInvoker{
+		Config: config,
+		Limits: &limits,
+	}
+}
+
+// ParseBindMount parses the bind mount specification in the form of "source[:target][:ro|:rw]".
+func ParseBindMount(spec string) (BindMount, error) {
+	parts := strings.Split(spec, ":")
+	if len(parts) > 3 || parts[0] == "" {
+		return BindMount{}, fmt.Errorf("malformed bind mount: %s", spec)
+	}
+
+	bind := BindMount{Source: parts[0], Target: parts[0]}
+	if len(parts) > 1 {
+		switch last := parts[len(parts)-1]; last {
+		case "ro", "rw":
+			bind.ReadOnly = last == "ro"
+			parts = parts[:len(parts)-1]
+		default:
+			if len(parts) == 3 {
+				return BindMount{}, fmt.Errorf("malformed bind mount mode: %s", spec)
+			}
+		}
+	}
+	if len(parts) == 2 {
+		bind.Target = parts[1]
+	}
+
+	if !filepath.IsAbs(bind.Source) || !filepath.IsAbs(bind.Target) {
+		return BindMount{}, fmt.Errorf("bind mount paths must be absolute: %s", spec)
+	}
+
+	return bind, nil
+}
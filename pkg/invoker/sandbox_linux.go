@@ -0,0 +1,352 @@
+package invoker
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// sandboxInitArg is the argv[0] of the sandbox helper process
+	sandboxInitArg = "slashes-sandbox-init"
+	// sandboxConfigEnv is the environment variable passing the sandbox configuration to the helper process
+	sandboxConfigEnv = "_SLASHES_SANDBOX_CONFIG"
+	// sandboxInitExitCode is the exit code of the helper process when the sandbox setup failed
+	sandboxInitExitCode = 126
+)
+
+// sandboxEnv is the names of the host environment variables passed to the sandbox,
+// the others such as the tokens of the server are never exposed to the command
+var sandboxEnv = []string{"PATH", "LANG"}
+
+// Invoke invokes the command in the sandbox and returns the exit code with console outputs.
+func (i *SandboxInvoker) Invoke(ctx context.Context, command string, args ...string) (int, string, error) {
+	// the mount point of the new root, it is only populated in the sandbox mount namespace
+	root, err := os.MkdirTemp("", "slashes-sandbox-")
+	if err != nil {
+		return -1, "", fmt.Errorf("failed to create sandbox root: %w", err)
+	}
+	defer os.Remove(root)
+
+	config, err := json.Marshal(&i.Config)
+	if err != nil {
+		return -1, "", err
+	}
+
+	// re-execute the current executable as the sandbox helper
+	cmd := exec.CommandContext(ctx, "/proc/self/exe", append([]string{root, command}, args...)...)
+	cmd.Args[0] = sandboxInitArg
+	if stdin, ok := StdinFrom(ctx); ok {
+		cmd.Stdin = strings.NewReader(stdin)
+	}
+	cmd.Env = []string{sandboxConfigEnv + "=" + string(config)}
+	for _, name := range sandboxEnv {
+		if value, ok := os.LookupEnv(name); ok {
+			cmd.Env = append(cmd.Env, name+"="+value)
+		}
+	}
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		Cloneflags: syscall.CLONE_NEWUSER | syscall.CLONE_NEWNS | syscall.CLONE_NEWPID |
+			syscall.CLONE_NEWUTS | syscall.CLONE_NEWIPC,
+		UidMappings: []syscall.SysProcIDMap{{ContainerID: 0, HostID: os.Getuid(), Size: 1}},
+		GidMappings: []syscall.SysProcIDMap{{ContainerID: 0, HostID: os.Getgid(), Size: 1}},
+		Pdeathsig:   syscall.SIGKILL,
+	}
+	if !i.Config.Network {
+		cmd.SysProcAttr.Cloneflags |= syscall.CLONE_NEWNET
+	}
+
+	return run(cmd, i.Limits)
+}
+
+// SandboxInit sets up the sandbox or the resource limits and executes the command if the current process
+// is the sandbox helper or the limits helper.
+// It returns immediately in any other process, and never returns in the helper processes.
+func SandboxInit() {
+	if len(os.Args) < 3 {
+		return
+	}
+
+	var err error
+	switch os.Args[0] {
+	case sandboxInitArg:
+		// capabilities are per thread, the thread dropping them must execute the command
+		runtime.LockOSThread()
+		err = sandboxInit(os.Args[1], os.Args[2], os.Args[3:])
+	case limitsInitArg:
+		err = limitsInit(os.Args[1], os.Args[2:])
+	default:
+		return
+	}
+
+	fmt.Fprintf(os.Stderr, "sandbox: %v\n", err)
+	os.Exit(sandboxInitExitCode)
+}
+
+// sandboxInit sets up the sandbox in the root directory and executes the command.
+func sandboxInit(root, command string, args []string) error {
+	var config SandboxConfig
+	if err := json.Unmarshal([]byte(os.Getenv(sandboxConfigEnv)), &config); err != nil {
+		return fmt.Errorf("malformed sandbox configuration: %w", err)
+	}
+	if err := os.Unsetenv(sandboxConfigEnv); err != nil {
+		return err
+	}
+	limits, err := readLimitsConfig()
+	if err != nil {
+		return err
+	}
+
+	// the cgroup is only writable before the root is changed
+	if err := limits.enterCgroup(); err != nil {
+		return err
+	}
+
+	// resolve the command before the root is changed
+	path, err := exec.LookPath(command)
+	if err != nil {
+		return err
+	}
+
+	if err := setupRoot(root, &config); err != nil {
+		return err
+	}
+
+	// enter the new root
+	if err := pivotRoot(root); err != nil {
+		return err
+	}
+
+	// root in the user namespace could remount the filesystem as writable, drop all the capabilities
+	if err := dropCapabilities(); err != nil {
+		return err
+	}
+
+	argv, env := append([]string{command}, args...), os.Environ()
+	if err := limits.setRlimits(); err != nil {
+		return err
+	}
+
+	return syscall.Exec(path, argv, env)
+}
+
+// setupRoot populates the new root directory with a read-only view of the host root filesystem.
+func setupRoot(root string, config *SandboxConfig) error {
+	// never propagate the mounts to the host
+	if err := unix.Mount("", "/", "", unix.MS_REC|unix.MS_PRIVATE, ""); err != nil {
+		return fmt.Errorf("failed to make mounts private: %w", err)
+	}
+
+	if err := unix.Mount("/", root, "", unix.MS_BIND|unix.MS_REC, ""); err != nil {
+		return fmt.Errorf("failed to bind root filesystem: %w", err)
+	}
+
+	// remount every mount under the new root as read-only
+	mounts, err := mountPoints(root)
+	if err != nil {
+		return err
+	}
+	for _, mount := range mounts {
+		if err := remountReadOnly(mount); err != nil {
+			return err
+		}
+	}
+
+	// private tmpfs
+	tmpfsOptions := "mode=1777"
+	if config.TmpfsSize != "" {
+		tmpfsOptions += ",size=" + config.TmpfsSize
+	}
+	if err := unix.Mount("tmpfs", filepath.Join(root, "tmp"), "tmpfs", unix.MS_NOSUID|unix.MS_NODEV, tmpfsOptions); err != nil {
+		return fmt.Errorf("failed to mount tmpfs: %w", err)
+	}
+
+	// procfs of the new PID namespace
+	if err := unix.Mount("proc", filepath.Join(root, "proc"), "proc", unix.MS_NOSUID|unix.MS_NODEV|unix.MS_NOEXEC, ""); err != nil {
+		return fmt.Errorf("failed to mount proc: %w", err)
+	}
+
+	// bind mounts from the configuration
+	for _, bind := range config.Binds {
+		target := filepath.Join(root, bind.Target)
+		if err := createMountPoint(bind.Source, target); err != nil {
+			return err
+		}
+
+		if err := unix.Mount(bind.Source, target, "", unix.MS_BIND|unix.MS_REC, ""); err != nil {
+			return fmt.Errorf("failed to bind %s to %s: %w", bind.Source, bind.Target, err)
+		}
+
+		if bind.ReadOnly {
+			if err := remountReadOnly(target); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// createMountPoint creates the mount point for the source if it does not exist.
+// It only succeeds in writable directories of the sandbox such as /tmp, since the root is read-only.
+func createMountPoint(source, target string) error {
+	if _, err := os.Stat(target); err == nil {
+		return nil
+	}
+
+	info, err := os.Stat(source)
+	if err != nil {
+		return err
+	}
+
+	if info.IsDir() {
+		if err := os.MkdirAll(target, 0o755); err != nil {
+			return fmt.Errorf("failed to create mount point: %w", err)
+		}
+
+		return nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+		return fmt.Errorf("failed to create mount point: %w", err)
+	}
+
+	f, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to create mount point: %w", err)
+	}
+
+	return f.Close()
+}
+
+// mountPoints returns the mount points under the directory, parents come first.
+func mountPoints(dir string) ([]string, error) {
+	f, err := os.Open("/proc/self/mountinfo")
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var mounts []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		// the fifth field is the mount point with octal escaped spaces
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 5 {
+			continue
+		}
+
+		mount := unescapeMountPoint(fields[4])
+		if mount == dir || strings.HasPrefix(mount, dir+"/") {
+			mounts = append(mounts, mount)
+		}
+	}
+
+	return mounts, scanner.Err()
+}
+
+// unescapeMountPoint decodes the octal escapes of the mount point in /proc/self/mountinfo.
+func unescapeMountPoint(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+3 < len(s) {
+			if c, err := strconv.ParseUint(s[i+1:i+4], 8, 8); err == nil {
+				b.WriteByte(byte(c))
+				i += 3
+				continue
+			}
+		}
+		b.WriteByte(s[i])
+	}
+
+	return b.String()
+}
+
+// remountReadOnly remounts the bind mount as read-only, keeping the flags locked by the user namespace.
+func remountReadOnly(path string) error {
+	var stat unix.Statfs_t
+	if err := unix.Statfs(path, &stat); err != nil {
+		return fmt.Errorf("failed to stat %s: %w", path, err)
+	}
+
+	flags := uintptr(unix.MS_REMOUNT | unix.MS_BIND | unix.MS_RDONLY)
+	for _, f := range []struct {
+		st int64
+		ms uintptr
+	}{
+		{unix.ST_NOSUID, unix.MS_NOSUID},
+		{unix.ST_NODEV, unix.MS_NODEV},
+		{unix.ST_NOEXEC, unix.MS_NOEXEC},
+		{unix.ST_NOATIME, unix.MS_NOATIME},
+		{unix.ST_NODIRATIME, unix.MS_NODIRATIME},
+		{unix.ST_RELATIME, unix.MS_RELATIME},
+	} {
+		if stat.Flags&f.st != 0 {
+			flags |= f.ms
+		}
+	}
+
+	if err := unix.Mount("", path, "", flags, ""); err != nil {
+		return fmt.Errorf("failed to remount %s as read-only: %w", path, err)
+	}
+
+	return nil
+}
+
+// pivotRoot changes the root filesystem to the directory and detaches the old one.
+func pivotRoot(root string) error {
+	if err := unix.Chdir(root); err != nil {
+		return err
+	}
+
+	// stack the old root on top of the new one, then detach it
+	if err := unix.PivotRoot(".", "."); err != nil {
+		return fmt.Errorf("failed to pivot root: %w", err)
+	}
+	if err := unix.Unmount(".", unix.MNT_DETACH); err != nil {
+		return fmt.Errorf("failed to detach old root: %w", err)
+	}
+
+	return unix.Chdir("/")
+}
+
+// dropCapabilities drops all the capabilities from the bounding set of the current thread,
+// so that the executed command has no capability even as root in the user namespace.
+func dropCapabilities() error {
+	if err := unix.Prctl(unix.PR_SET_NO_NEW_PRIVS, 1, 0, 0, 0); err != nil {
+		return fmt.Errorf("failed to set no_new_privs: %w", err)
+	}
+
+	for c := 0; c <= unix.CAP_LAST_CAP; c++ {
+		if err := unix.Prctl(unix.PR_CAPBSET_DROP, uintptr(c), 0, 0, 0); err != nil && err != unix.EINVAL {
+			return fmt.Errorf("failed to drop capability %d: %w", c, err)
+		}
+	}
+
+	// the inheritable and ambient sets are kept over execve
+	if err := unix.Prctl(unix.PR_CAP_AMBIENT, unix.PR_CAP_AMBIENT_CLEAR_ALL, 0, 0, 0); err != nil {
+		return fmt.Errorf("failed to clear ambient capabilities: %w", err)
+	}
+
+	header := unix.CapUserHeader{Version: unix.LINUX_CAPABILITY_VERSION_3}
+	var data [2]unix.CapUserData
+	if err := unix.Capget(&header, &data[0]); err != nil {
+		return fmt.Errorf("failed to get capabilities: %w", err)
+	}
+	data[0].Inheritable, data[1].Inheritable = 0, 0
+	if err := unix.Capset(&header, &data[0]); err != nil {
+		return fmt.Errorf("failed to clear inheritable capabilities: %w", err)
+	}
+
+	return nil
+}
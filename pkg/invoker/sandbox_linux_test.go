@@ -0,0 +1,160 @@
+package invoker
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+// TestMain runs the sandbox helper when the test binary is re-executed by SandboxInvoker.
+func TestMain(m *testing.M) {
+	SandboxInit()
+	os.Exit(m.Run())
+}
+
+// SandboxInvokerTestSuite is a test suite for SandboxInvoker
+type SandboxInvokerTestSuite struct {
+	suite.Suite
+}
+
+// SetupTest skips the tests if user namespaces are not available.
+func (suite *SandboxInvokerTestSuite) SetupTest() {
+	exitCode, output, err := NewSandboxInvoker(SandboxConfig{}, Limits{}).Invoke(context.Background(), "true")
+	if err != nil || exitCode != 0 {
+		suite.T().Skipf("sandbox is not available: %v %s", err, output)
+	}
+}
+
+// TestInvokeSuccess tests the success case of invoking a command in the sandbox
+func (suite *SandboxInvokerTestSuite) TestInvokeSuccess() {
+	ctx := context.Background()
+	invoker := NewSandboxInvoker(SandboxConfig{}, Limits{})
+	exitCode, output, err := invoker.Invoke(ctx, "echo", "hello world")
+
+	// assert
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), 0, exitCode)
+	assert.Equal(suite.T(), "hello world\n", output)
+}
+
+// TestInvokeReadOnlyRoot tests the root filesystem is read-only and /tmp is private
+func (suite *SandboxInvokerTestSuite) TestInvokeReadOnlyRoot() {
+	ctx := context.Background()
+	dir := suite.T().TempDir()
+	invoker := NewSandboxInvoker(SandboxConfig{}, Limits{})
+
+	// writing to the root filesystem fails
+	exitCode, _, err := invoker.Invoke(ctx, "touch", filepath.Join(dir, "file"))
+	assert.Error(suite.T(), err)
+	assert.NotEqual(suite.T(), 0, exitCode)
+	assert.NoFileExists(suite.T(), filepath.Join(dir, "file"))
+
+	// the command can not remount the root filesystem as writable
+	exitCode, _, err = invoker.Invoke(ctx, "mount", "-o", "remount,rw", "/")
+	assert.Error(suite.T(), err)
+	assert.NotEqual(suite.T(), 0, exitCode)
+
+	// writing to the private tmpfs succeeds, and the host does not see it
+	exitCode, output, err := invoker.Invoke(ctx, "bash", "-c", "echo hello > /tmp/hello && ls /tmp")
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), 0, exitCode)
+	assert.Equal(suite.T(), "hello\n", output)
+}
+
+// TestInvokeBindMount tests the bind mounts of the sandbox
+func (suite *SandboxInvokerTestSuite) TestInvokeBindMount() {
+	ctx := context.Background()
+	rw := suite.T().TempDir()
+	ro := suite.T().TempDir()
+	invoker := NewSandboxInvoker(SandboxConfig{
+		Binds: []BindMount{
+			{Source: rw, Target: rw},
+			{Source: rw, Target: ro, ReadOnly: true},
+		},
+	}, Limits{})
+
+	// writable bind mount
+	exitCode, _, err := invoker.Invoke(ctx, "touch", filepath.Join(rw, "file"))
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), 0, exitCode)
+	assert.FileExists(suite.T(), filepath.Join(rw, "file"))
+
+	// read-only bind mount
+	exitCode, output, err := invoker.Invoke(ctx, "ls", ro)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), 0, exitCode)
+	assert.Equal(suite.T(), "file\n", output)
+
+	exitCode, _, err = invoker.Invoke(ctx, "rm", filepath.Join(ro, "file"))
+	assert.Error(suite.T(), err)
+	assert.NotEqual(suite.T(), 0, exitCode)
+}
+
+// TestInvokeNamespaces tests the command runs in new PID and network namespaces
+func (suite *SandboxInvokerTestSuite) TestInvokeNamespaces() {
+	ctx := context.Background()
+	invoker := NewSandboxInvoker(SandboxConfig{}, Limits{})
+
+	// the command is the init process of the PID namespace
+	exitCode, output, err := invoker.Invoke(ctx, "bash", "-c", "echo $$")
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), 0, exitCode)
+	assert.Equal(suite.T(), "1\n", output)
+
+	// only the loopback interface exists
+	exitCode, output, err = invoker.Invoke(ctx, "bash", "-c", "tail -n +3 /proc/net/dev | cut -d: -f1 | tr -d ' '")
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), 0, exitCode)
+	assert.Equal(suite.T(), "lo\n", output)
+}
+
+// TestInvokeEnv tests only the allowed environment variables of the host are visible in the sandbox
+func (suite *SandboxInvokerTestSuite) TestInvokeEnv() {
+	suite.T().Setenv("SLASHES_SLACK_BOT_TOKEN", "xoxb-secret")
+	suite.T().Setenv("LANG", "C.UTF-8")
+
+	ctx := context.Background()
+	invoker := NewSandboxInvoker(SandboxConfig{}, Limits{OpenFiles: 64})
+	exitCode, output, err := invoker.Invoke(ctx, "env")
+
+	// assert
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), 0, exitCode)
+	assert.NotContains(suite.T(), output, "xoxb-secret")
+	assert.NotContains(suite.T(), output, "_SLASHES_")
+	assert.Contains(suite.T(), output, "PATH="+os.Getenv("PATH")+"\n")
+	assert.Contains(suite.T(), output, "LANG=C.UTF-8\n")
+}
+
+// TestInvokeLimits tests the limits are already applied when the command starts in the sandbox
+func (suite *SandboxInvokerTestSuite) TestInvokeLimits() {
+	ctx := context.Background()
+	invoker := NewSandboxInvoker(SandboxConfig{}, Limits{OpenFiles: 64})
+	exitCode, output, err := invoker.Invoke(ctx, "sh", "-c", "ulimit -n")
+
+	// assert
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), 0, exitCode)
+	assert.Equal(suite.T(), "64\n", output)
+}
+
+// TestInvokeFailureTimeout tests the failure case of invoking a command that times out in the sandbox
+func (suite *SandboxInvokerTestSuite) TestInvokeFailureTimeout() {
+	ctx, cancelFunc := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancelFunc()
+	invoker := NewSandboxInvoker(SandboxConfig{}, Limits{})
+	exitCode, _, err := invoker.Invoke(ctx, "sleep", "10")
+
+	// assert
+	assert.Error(suite.T(), err)
+	assert.Equal(suite.T(), -1, exitCode)
+}
+
+func TestSandboxInvokerTestSuite(t *testing.T) {
+	suite.Run(t, new(SandboxInvokerTestSuite))
+}
@@ -0,0 +1,16 @@
+//go:build !linux
+
+package invoker
+
+import (
+	"context"
+	"errors"
+)
+
+// Invoke returns an error because the sandbox is only supported on Linux.
+func (i *SandboxInvoker) Invoke(ctx context.Context, command string, args ...string) (int, string, error) {
+	return -1, "", errors.New("sandbox is not supported on this platform")
+}
+
+// SandboxInit does nothing because the sandbox is only supported on Linux.
+func SandboxInit() {}
@@ -0,0 +1,36 @@
+package invoker
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestParseBindMount tests parsing the bind mount specifications
+func TestParseBindMount(t *testing.T) {
+	cases := []struct {
+		spec     string
+		expected BindMount
+		err      bool
+	}{
+		{spec: "/data", expected: BindMount{Source: "/data", Target: "/data"}},
+		{spec: "/data:ro", expected: BindMount{Source: "/data", Target: "/data", ReadOnly: true}},
+		{spec: "/data:/mnt", expected: BindMount{Source: "/data", Target: "/mnt"}},
+		{spec: "/data:/mnt:rw", expected: BindMount{Source: "/data", Target: "/mnt"}},
+		{spec: "/data:/mnt:ro", expected: BindMount{Source: "/data", Target: "/mnt", ReadOnly: true}},
+		{spec: "/data:/mnt:xx", err: true},
+		{spec: "data:/mnt", err: true},
+		{spec: "", err: true},
+	}
+
+	for _, c := range cases {
+		bind, err := ParseBindMount(c.spec)
+		if c.err {
+			assert.Error(t, err, c.spec)
+			continue
+		}
+
+		assert.NoError(t, err, c.spec)
+		assert.Equal(t, c.expected, bind, c.spec)
+	}
+}
@@ -0,0 +1,153 @@
+package invoker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// SSHConfig is the configuration of the remote host.
+type SSHConfig struct {
+	// Addr is the address of the remote host in the form of "host:port"
+	Addr string
+	// User is the user name on the remote host
+	User string
+	// KeyFile is the path of the private key used for authentication
+	KeyFile string
+	// KnownHostsFile is the path of the known_hosts file used for host key verification
+	KnownHostsFile string
+}
+
+// SSHInvoker is an Invoker implementation which runs the command on a remote host over SSH.
+type SSHInvoker struct {
+	// Addr is the address of the remote host
+	Addr string
+
+	// clientConfig is the ssh client configuration
+	clientConfig *ssh.ClientConfig
+}
+
+// NewSSHInvoker returns a new SSH Invoker instance.
+func NewSSHInvoker(config SSHConfig) (Invoker, error) {
+	key, err := os.ReadFile(config.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read private key: %w", err)
+	}
+
+	signer, err := ssh.ParsePrivateKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse private key: %w", err)
+	}
+
+	hostKeyCallback, err := knownhosts.New(config.KnownHostsFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read known_hosts: %w", err)
+	}
+
+	return &SSHInvoker{
+		Addr: config.Addr,
+		clientConfig: &ssh.ClientConfig{
+			User:            config.User,
+			Auth:            []ssh.AuthMethod{ssh.PublicKeys(signer)},
+			HostKeyCallback: hostKeyCallback,
+		},
+	}, nil
+}
+
+// Invoke invokes the command on the remote host and returns the exit code with console outputs.
+func (i *SSHInvoker) Invoke(ctx context.Context, command string, args ...string) (int, string, error) {
+	client, err := i.dial(ctx)
+	if err != nil {
+		return -1, "", err
+	}
+	defer client.Close()
+
+	session, err := client.NewSession()
+	if err != nil {
+		return -1, "", fmt.Errorf("failed to open session: %w", err)
+	}
+	defer session.Close()
+
+	// run the command, stdout and stderr are copied to the output in separate goroutines
+	out := &syncBuffer{}
+	session.Stdout = out
+	session.Stderr = out
+	if stdin, ok := StdinFrom(ctx); ok {
+		session.Stdin = strings.NewReader(stdin)
+	}
+	if err := session.Start(ShellQuote(append([]string{command}, args...)...)); err != nil {
+		return -1, "", fmt.Errorf("failed to start command: %w", err)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- session.Wait()
+	}()
+
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		// the remote process is not killed by closing the connection, ask the server to kill it first
+		if err := session.Signal(ssh.SIGKILL); err != nil {
+			_ = session.Close()
+		}
+		_ = client.Close()
+		<-done
+		return -1, out.String(), ctx.Err()
+	}
+
+	// return the remote exit status
+	var exitErr *ssh.ExitError
+	switch {
+	case err == nil:
+		return 0, out.String(), nil
+	case errors.As(err, &exitErr):
+		return exitErr.ExitStatus(), out.String(), err
+	default:
+		return -1, out.String(), err
+	}
+}
+
+// dial connects to the remote host.
+func (i *SSHInvoker) dial(ctx context.Context) (*ssh.Client, error) {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", i.Addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to %s: %w", i.Addr, err)
+	}
+
+	// abort the handshake on cancellation
+	handshaked := make(chan struct{})
+	defer close(handshaked)
+	go func() {
+		select {
+		case <-ctx.Done():
+			_ = conn.Close()
+		case <-handshaked:
+		}
+	}()
+
+	c, chans, reqs, err := ssh.NewClientConn(conn, i.Addr, i.clientConfig)
+	if err != nil {
+		_ = conn.Close()
+		return nil, fmt.Errorf("failed to establish ssh connection to %s: %w", i.Addr, err)
+	}
+
+	return ssh.NewClient(c, chans, reqs), nil
+}
+
+// ShellQuote quotes the words for POSIX shells, so that each word is passed as a single argument.
+func ShellQuote(words ...string) string {
+	quoted := make([]string, len(words))
+	for n, word := range words {
+		quoted[n] = "'" + strings.ReplaceAll(word, "'", `'\''`) + "'"
+	}
+
+	return strings.Join(quoted, " ")
+}
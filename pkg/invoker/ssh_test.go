@@ -0,0 +1,316 @@
+package invoker
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// SSHInvokerTestSuite is a test suite for SSHInvoker
+type SSHInvokerTestSuite struct {
+	suite.Suite
+
+	server *sshServer
+	config SSHConfig
+}
+
+// SetupTest starts a local ssh server which runs the commands with sh.
+func (suite *SSHInvokerTestSuite) SetupTest() {
+	dir := suite.T().TempDir()
+
+	// client key
+	_, clientKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(suite.T(), err)
+	der, err := x509.MarshalPKCS8PrivateKey(clientKey)
+	require.NoError(suite.T(), err)
+	keyFile := filepath.Join(dir, "id_ed25519")
+	require.NoError(suite.T(), os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0o600))
+	clientSigner, err := ssh.NewSignerFromKey(clientKey)
+	require.NoError(suite.T(), err)
+
+	// server
+	suite.server = newSSHServer(suite.T(), clientSigner.PublicKey())
+
+	// known_hosts
+	knownHostsFile := filepath.Join(dir, "known_hosts")
+	line := knownhosts.Line([]string{suite.server.listener.Addr().String()}, suite.server.hostKey.PublicKey())
+	require.NoError(suite.T(), os.WriteFile(knownHostsFile, []byte(line+"\n"), 0o600))
+
+	suite.config = SSHConfig{
+		Addr:           suite.server.listener.Addr().String(),
+		User:           "miku",
+		KeyFile:        keyFile,
+		KnownHostsFile: knownHostsFile,
+	}
+}
+
+// TearDownTest stops the local ssh server.
+func (suite *SSHInvokerTestSuite) TearDownTest() {
+	suite.server.listener.Close()
+}
+
+// TestInvokeSuccess tests the success case of invoking a command on the remote host
+func (suite *SSHInvokerTestSuite) TestInvokeSuccess() {
+	ctx := context.Background()
+	invoker, err := NewSSHInvoker(suite.config)
+	require.NoError(suite.T(), err)
+	exitCode, output, err := invoker.Invoke(ctx, "echo", "hello world", "it's; $HOME")
+
+	// assert
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), 0, exitCode)
+	assert.Equal(suite.T(), "hello world it's; $HOME\n", output)
+	assert.Equal(suite.T(), `'echo' 'hello world' 'it'\''s; $HOME'`, suite.server.command())
+}
+
+// TestInvokeFailureExitStatus tests the failure case of a command exiting with non-zero status on the remote host
+func (suite *SSHInvokerTestSuite) TestInvokeFailureExitStatus() {
+	ctx := context.Background()
+	invoker, err := NewSSHInvoker(suite.config)
+	require.NoError(suite.T(), err)
+	exitCode, output, err := invoker.Invoke(ctx, "sh", "-c", "echo failed >&2; exit 3")
+
+	// assert
+	assert.Error(suite.T(), err)
+	assert.Equal(suite.T(), 3, exitCode)
+	assert.Equal(suite.T(), "failed\n", output)
+}
+
+// TestInvokeFailureTimeout tests the failure case of a command that times out on the remote host
+func (suite *SSHInvokerTestSuite) TestInvokeFailureTimeout() {
+	ctx, cancelFunc := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancelFunc()
+	invoker, err := NewSSHInvoker(suite.config)
+	require.NoError(suite.T(), err)
+	exitCode, _, err := invoker.Invoke(ctx, "sleep", "10")
+
+	// assert
+	assert.ErrorIs(suite.T(), err, context.DeadlineExceeded)
+	assert.Equal(suite.T(), -1, exitCode)
+	assert.Eventually(suite.T(), func() bool {
+		return suite.server.signal() == "KILL"
+	}, time.Second, 10*time.Millisecond)
+}
+
+// TestInvokeFailureHostKey tests the failure case of an unknown host key
+func (suite *SSHInvokerTestSuite) TestInvokeFailureHostKey() {
+	_, otherKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(suite.T(), err)
+	otherSigner, err := ssh.NewSignerFromKey(otherKey)
+	require.NoError(suite.T(), err)
+	line := knownhosts.Line([]string{suite.config.Addr}, otherSigner.PublicKey())
+	require.NoError(suite.T(), os.WriteFile(suite.config.KnownHostsFile, []byte(line+"\n"), 0o600))
+
+	ctx := context.Background()
+	invoker, err := NewSSHInvoker(suite.config)
+	require.NoError(suite.T(), err)
+	exitCode, _, err := invoker.Invoke(ctx, "echo", "hello world")
+
+	// assert
+	assert.Error(suite.T(), err)
+	assert.Equal(suite.T(), -1, exitCode)
+	assert.Empty(suite.T(), suite.server.command())
+}
+
+// TestInvokeInterleavedOutput tests keeping all the output of a command writing to stdout and stderr in turn
+func (suite *SSHInvokerTestSuite) TestInvokeInterleavedOutput() {
+	ctx := context.Background()
+	invoker, err := NewSSHInvoker(suite.config)
+	require.NoError(suite.T(), err)
+	exitCode, output, err := invoker.Invoke(ctx, "sh", "-c", "i=0; while [ $i -lt 1000 ]; do echo out$i; echo err$i >&2; i=$((i+1)); done")
+
+	// assert
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), 0, exitCode)
+	lines := strings.Split(strings.TrimSuffix(output, "\n"), "\n")
+	assert.Len(suite.T(), lines, 2000)
+	assert.ElementsMatch(suite.T(), interleavedLines(1000), lines)
+}
+
+// interleavedLines returns the lines written by the interleaving command
+func interleavedLines(n int) []string {
+	lines := make([]string, 0, 2*n)
+	for i := 0; i < n; i++ {
+		lines = append(lines, fmt.Sprintf("out%d", i), fmt.Sprintf("err%d", i))
+	}
+	return lines
+}
+
+// TestInvokeStdin tests the success case of invoking a command with standard input on the remote host
+func (suite *SSHInvokerTestSuite) TestInvokeStdin() {
+	ctx := WithStdin(context.Background(), "don't forget")
+	invoker, err := NewSSHInvoker(suite.config)
+	require.NoError(suite.T(), err)
+	exitCode, output, err := invoker.Invoke(ctx, "cat")
+
+	// assert
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), 0, exitCode)
+	assert.Equal(suite.T(), "don't forget", output)
+}
+
+func TestSSHInvokerTestSuite(t *testing.T) {
+	suite.Run(t, new(SSHInvokerTestSuite))
+}
+
+// TestShellQuote tests quoting the words for POSIX shells
+func TestShellQuote(t *testing.T) {
+	assert.Equal(t, `'echo'`, ShellQuote("echo"))
+	assert.Equal(t, `'echo' '' 'a b'`, ShellQuote("echo", "", "a b"))
+	assert.Equal(t, `'echo' ''\''; rm -rf /'`, ShellQuote("echo", "'; rm -rf /"))
+}
+
+// sshServer is a minimal ssh server which runs the exec requests with sh.
+type sshServer struct {
+	listener net.Listener
+	hostKey  ssh.Signer
+
+	mu            sync.Mutex
+	lastCommand   string
+	lastSignal    string
+	serverConfig  *ssh.ServerConfig
+	authorizedKey ssh.PublicKey
+}
+
+// newSSHServer starts a new ssh server which accepts the authorized key.
+func newSSHServer(t *testing.T, authorizedKey ssh.PublicKey) *sshServer {
+	_, hostKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	hostSigner, err := ssh.NewSignerFromKey(hostKey)
+	require.NoError(t, err)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	s := &sshServer{
+		listener:      listener,
+		hostKey:       hostSigner,
+		authorizedKey: authorizedKey,
+	}
+	s.serverConfig = &ssh.ServerConfig{
+		PublicKeyCallback: func(conn ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if string(key.Marshal()) != string(s.authorizedKey.Marshal()) {
+				return nil, assert.AnError
+			}
+			return &ssh.Permissions{}, nil
+		},
+	}
+	s.serverConfig.AddHostKey(hostSigner)
+
+	go s.serve()
+	return s
+}
+
+// command returns the last executed command.
+func (s *sshServer) command() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.lastCommand
+}
+
+// signal returns the last received signal.
+func (s *sshServer) signal() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.lastSignal
+}
+
+// serve accepts the connections.
+func (s *sshServer) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+
+		go s.handleConn(conn)
+	}
+}
+
+// handleConn handles the session channels of the connection.
+func (s *sshServer) handleConn(conn net.Conn) {
+	_, chans, reqs, err := ssh.NewServerConn(conn, s.serverConfig)
+	if err != nil {
+		return
+	}
+	go ssh.DiscardRequests(reqs)
+
+	for newChannel := range chans {
+		if newChannel.ChannelType() != "session" {
+			_ = newChannel.Reject(ssh.UnknownChannelType, "unknown channel type")
+			continue
+		}
+
+		channel, requests, err := newChannel.Accept()
+		if err != nil {
+			return
+		}
+
+		go s.handleSession(channel, requests)
+	}
+}
+
+// handleSession handles the exec and signal requests of the session.
+func (s *sshServer) handleSession(channel ssh.Channel, requests <-chan *ssh.Request) {
+	var cmd *exec.Cmd
+	for req := range requests {
+		switch req.Type {
+		case "exec":
+			var payload struct{ Command string }
+			if err := ssh.Unmarshal(req.Payload, &payload); err != nil {
+				_ = req.Reply(false, nil)
+				continue
+			}
+
+			s.mu.Lock()
+			s.lastCommand = payload.Command
+			s.mu.Unlock()
+
+			cmd = exec.Command("sh", "-c", payload.Command)
+			cmd.Stdin = channel
+			cmd.Stdout = channel
+			cmd.Stderr = channel.Stderr()
+			if err := cmd.Start(); err != nil {
+				_ = req.Reply(false, nil)
+				continue
+			}
+			_ = req.Reply(true, nil)
+
+			go func(cmd *exec.Cmd) {
+				_ = cmd.Wait()
+				status := struct{ Status uint32 }{uint32(cmd.ProcessState.ExitCode())}
+				_, _ = channel.SendRequest("exit-status", false, ssh.Marshal(&status))
+				_ = channel.Close()
+			}(cmd)
+		case "signal":
+			var payload struct{ Signal string }
+			if err := ssh.Unmarshal(req.Payload, &payload); err == nil {
+				s.mu.Lock()
+				s.lastSignal = payload.Signal
+				s.mu.Unlock()
+			}
+			if cmd != nil && payload.Signal == "KILL" {
+				_ = cmd.Process.Kill()
+			}
+		default:
+			_ = req.Reply(false, nil)
+		}
+	}
+}
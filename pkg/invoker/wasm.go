@@ -0,0 +1,125 @@
+package invoker
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/imports/wasi_snapshot_preview1"
+	"github.com/tetratelabs/wazero/sys"
+)
+
+const (
+	// wasmPageSize is the size of a WebAssembly memory page
+	wasmPageSize = 65536
+	// wasmMaxPages is the maximum number of the memory pages of a module (4GiB)
+	wasmMaxPages = 65536
+)
+
+// WasmConfig is the configuration of the WebAssembly runtime.
+type WasmConfig struct {
+	// Env is the names of the host environment variables passed to the module
+	Env []string
+	// MemoryLimit is the maximum memory of the module in bytes, zero means the runtime default (4GiB).
+	// It is rounded up to whole memory pages.
+	MemoryLimit uint64
+}
+
+// memoryLimitPages returns the memory limit in pages, zero means the runtime default.
+func (c *WasmConfig) memoryLimitPages() (uint32, error) {
+	if c.MemoryLimit > wasmMaxPages*wasmPageSize {
+		return 0, fmt.Errorf("memory limit must be at most 4GiB: %d", c.MemoryLimit)
+	}
+
+	return uint32((c.MemoryLimit + wasmPageSize - 1) / wasmPageSize), nil
+}
+
+// WasmInvoker is an Invoker implementation which runs the command as a WASI module
+// in a pure Go WebAssembly runtime instead of a native executable.
+// The command is the filesystem path of the module, which has no access to the host filesystem and network.
+type WasmInvoker struct {
+	// Config is the configuration of the runtime
+	Config WasmConfig
+
+	// cache is the compilation cache shared by the runtimes
+	cache wazero.CompilationCache
+}
+
+// NewWasmInvoker returns a new Wasm Invoker instance.
+func NewWasmInvoker(config WasmConfig) (Invoker, error) {
+	if _, err := config.memoryLimitPages(); err != nil {
+		return nil, err
+	}
+
+	return &WasmInvoker{
+		Config: config,
+		cache:  wazero.NewCompilationCache(),
+	}, nil
+}
+
+// Invoke runs the WASI module and returns the exit code with console outputs.
+func (i *WasmInvoker) Invoke(ctx context.Context, command string, args ...string) (int, string, error) {
+	module, err := os.ReadFile(command)
+	if err != nil {
+		return -1, "", err
+	}
+
+	// the runtime is created for each invocation to apply the memory limit and the context
+	runtimeConfig := wazero.NewRuntimeConfig().
+		WithCompilationCache(i.cache).
+		WithCloseOnContextDone(true)
+	pages, err := i.Config.memoryLimitPages()
+	if err != nil {
+		return -1, "", err
+	}
+	if pages > 0 {
+		runtimeConfig = runtimeConfig.WithMemoryLimitPages(pages)
+	}
+
+	runtime := wazero.NewRuntimeWithConfig(ctx, runtimeConfig)
+	defer runtime.Close(context.Background())
+
+	if _, err := wasi_snapshot_preview1.Instantiate(ctx, runtime); err != nil {
+		return -1, "", fmt.Errorf("failed to instantiate WASI: %w", err)
+	}
+
+	compiled, err := runtime.CompileModule(ctx, module)
+	if err != nil {
+		return -1, "", fmt.Errorf("failed to compile module: %w", err)
+	}
+
+	var out bytes.Buffer
+	moduleConfig := wazero.NewModuleConfig().
+		WithArgs(append([]string{command}, args...)...).
+		WithStdout(&out).
+		WithStderr(&out)
+	if stdin, ok := StdinFrom(ctx); ok {
+		moduleConfig = moduleConfig.WithStdin(strings.NewReader(stdin))
+	}
+	for _, name := range i.Config.Env {
+		if value, ok := os.LookupEnv(name); ok {
+			moduleConfig = moduleConfig.WithEnv(name, value)
+		}
+	}
+
+	// run the module
+	_, err = runtime.InstantiateModule(ctx, compiled, moduleConfig)
+
+	var exitErr *sys.ExitError
+	switch {
+	case err == nil:
+		return 0, out.String(), nil
+	case ctx.Err() != nil:
+		return -1, out.String(), ctx.Err()
+	case errors.As(err, &exitErr) && exitErr.ExitCode() == 0:
+		return 0, out.String(), nil
+	case errors.As(err, &exitErr):
+		return int(exitErr.ExitCode()), out.String(), err
+	default:
+		return -1, out.String(), err
+	}
+}
@@ -0,0 +1,212 @@
+package invoker
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+// testModule is a WASI module which writes the NUL separated arguments to stdout and
+// the NUL separated environment variables to stderr, then behaves by the first character of the first argument:
+// "l" loops forever, "g" grows the memory by 1000 pages and "x" exits with 3.
+//
+//	(module
+//	  (import "wasi_snapshot_preview1" "args_sizes_get" (func (param i32 i32) (result i32)))
+//	  (import "wasi_snapshot_preview1" "args_get" (func (param i32 i32) (result i32)))
+//	  (import "wasi_snapshot_preview1" "environ_sizes_get" (func (param i32 i32) (result i32)))
+//	  (import "wasi_snapshot_preview1" "environ_get" (func (param i32 i32) (result i32)))
+//	  (import "wasi_snapshot_preview1" "fd_write" (func (param i32 i32 i32 i32) (result i32)))
+//	  (import "wasi_snapshot_preview1" "proc_exit" (func (param i32)))
+//	  (memory (export "memory") 1)
+//	  (func (export "_start") (local i32)
+//	    (drop (call 0 (i32.const 0) (i32.const 4)))
+//	    (drop (call 1 (i32.const 1024) (i32.const 2048)))
+//	    (local.set 0 (if (result i32) (i32.gt_u (i32.load (i32.const 0)) (i32.const 1))
+//	      (then (i32.load8_u (i32.load (i32.const 1028)))) (else (i32.const 0))))
+//	    (i32.store (i32.const 16) (i32.const 2048))
+//	    (i32.store (i32.const 20) (i32.load (i32.const 4)))
+//	    (drop (call 4 (i32.const 1) (i32.const 16) (i32.const 1) (i32.const 8)))
+//	    (drop (call 2 (i32.const 0) (i32.const 4)))
+//	    (drop (call 3 (i32.const 1024) (i32.const 2048)))
+//	    (i32.store (i32.const 16) (i32.const 2048))
+//	    (i32.store (i32.const 20) (i32.load (i32.const 4)))
+//	    (drop (call 4 (i32.const 2) (i32.const 16) (i32.const 1) (i32.const 8)))
+//	    (if (i32.eq (local.get 0) (i32.const 108)) (then (loop (br 0))))
+//	    (if (i32.eq (local.get 0) (i32.const 103))
+//	      (then (if (i32.eq (memory.grow (i32.const 1000)) (i32.const -1)) (then unreachable))))
+//	    (if (i32.eq (local.get 0) (i32.const 120)) (then (call 5 (i32.const 3))))))
+var testModule = []byte{
+	0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00, 0x01, 0x16, 0x04, 0x60,
+	0x02, 0x7f, 0x7f, 0x01, 0x7f, 0x60, 0x04, 0x7f, 0x7f, 0x7f, 0x7f, 0x01,
+	0x7f, 0x60, 0x01, 0x7f, 0x00, 0x60, 0x00, 0x00, 0x02, 0xe0, 0x01, 0x06,
+	0x16, 0x77, 0x61, 0x73, 0x69, 0x5f, 0x73, 0x6e, 0x61, 0x70, 0x73, 0x68,
+	0x6f, 0x74, 0x5f, 0x70, 0x72, 0x65, 0x76, 0x69, 0x65, 0x77, 0x31, 0x0e,
+	0x61, 0x72, 0x67, 0x73, 0x5f, 0x73, 0x69, 0x7a, 0x65, 0x73, 0x5f, 0x67,
+	0x65, 0x74, 0x00, 0x00, 0x16, 0x77, 0x61, 0x73, 0x69, 0x5f, 0x73, 0x6e,
+	0x61, 0x70, 0x73, 0x68, 0x6f, 0x74, 0x5f, 0x70, 0x72, 0x65, 0x76, 0x69,
+	0x65, 0x77, 0x31, 0x08, 0x61, 0x72, 0x67, 0x73, 0x5f, 0x67, 0x65, 0x74,
+	0x00, 0x00, 0x16, 0x77, 0x61, 0x73, 0x69, 0x5f, 0x73, 0x6e, 0x61, 0x70,
+	0x73, 0x68, 0x6f, 0x74, 0x5f, 0x70, 0x72, 0x65, 0x76, 0x69, 0x65, 0x77,
+	0x31, 0x11, 0x65, 0x6e, 0x76, 0x69, 0x72, 0x6f, 0x6e, 0x5f, 0x73, 0x69,
+	0x7a, 0x65, 0x73, 0x5f, 0x67, 0x65, 0x74, 0x00, 0x00, 0x16, 0x77, 0x61,
+	0x73, 0x69, 0x5f, 0x73, 0x6e, 0x61, 0x70, 0x73, 0x68, 0x6f, 0x74, 0x5f,
+	0x70, 0x72, 0x65, 0x76, 0x69, 0x65, 0x77, 0x31, 0x0b, 0x65, 0x6e, 0x76,
+	0x69, 0x72, 0x6f, 0x6e, 0x5f, 0x67, 0x65, 0x74, 0x00, 0x00, 0x16, 0x77,
+	0x61, 0x73, 0x69, 0x5f, 0x73, 0x6e, 0x61, 0x70, 0x73, 0x68, 0x6f, 0x74,
+	0x5f, 0x70, 0x72, 0x65, 0x76, 0x69, 0x65, 0x77, 0x31, 0x08, 0x66, 0x64,
+	0x5f, 0x77, 0x72, 0x69, 0x74, 0x65, 0x00, 0x01, 0x16, 0x77, 0x61, 0x73,
+	0x69, 0x5f, 0x73, 0x6e, 0x61, 0x70, 0x73, 0x68, 0x6f, 0x74, 0x5f, 0x70,
+	0x72, 0x65, 0x76, 0x69, 0x65, 0x77, 0x31, 0x09, 0x70, 0x72, 0x6f, 0x63,
+	0x5f, 0x65, 0x78, 0x69, 0x74, 0x00, 0x02, 0x03, 0x02, 0x01, 0x03, 0x05,
+	0x03, 0x01, 0x00, 0x01, 0x07, 0x13, 0x02, 0x06, 0x6d, 0x65, 0x6d, 0x6f,
+	0x72, 0x79, 0x02, 0x00, 0x06, 0x5f, 0x73, 0x74, 0x61, 0x72, 0x74, 0x00,
+	0x06, 0x0a, 0xaa, 0x01, 0x01, 0xa7, 0x01, 0x01, 0x01, 0x7f, 0x41, 0x00,
+	0x41, 0x04, 0x10, 0x00, 0x1a, 0x41, 0x80, 0x08, 0x41, 0x80, 0x10, 0x10,
+	0x01, 0x1a, 0x41, 0x00, 0x28, 0x02, 0x00, 0x41, 0x01, 0x4b, 0x04, 0x7f,
+	0x41, 0x84, 0x08, 0x28, 0x02, 0x00, 0x2d, 0x00, 0x00, 0x05, 0x41, 0x00,
+	0x0b, 0x21, 0x00, 0x41, 0x10, 0x41, 0x80, 0x10, 0x36, 0x02, 0x00, 0x41,
+	0x14, 0x41, 0x04, 0x28, 0x02, 0x00, 0x36, 0x02, 0x00, 0x41, 0x01, 0x41,
+	0x10, 0x41, 0x01, 0x41, 0x08, 0x10, 0x04, 0x1a, 0x41, 0x00, 0x41, 0x04,
+	0x10, 0x02, 0x1a, 0x41, 0x80, 0x08, 0x41, 0x80, 0x10, 0x10, 0x03, 0x1a,
+	0x41, 0x10, 0x41, 0x80, 0x10, 0x36, 0x02, 0x00, 0x41, 0x14, 0x41, 0x04,
+	0x28, 0x02, 0x00, 0x36, 0x02, 0x00, 0x41, 0x02, 0x41, 0x10, 0x41, 0x01,
+	0x41, 0x08, 0x10, 0x04, 0x1a, 0x20, 0x00, 0x41, 0xec, 0x00, 0x46, 0x04,
+	0x40, 0x03, 0x40, 0x0c, 0x00, 0x0b, 0x0b, 0x20, 0x00, 0x41, 0xe7, 0x00,
+	0x46, 0x04, 0x40, 0x41, 0xe8, 0x07, 0x40, 0x00, 0x41, 0x7f, 0x46, 0x04,
+	0x40, 0x00, 0x0b, 0x0b, 0x20, 0x00, 0x41, 0xf8, 0x00, 0x46, 0x04, 0x40,
+	0x41, 0x03, 0x10, 0x05, 0x0b, 0x0b,
+}
+
+// WasmInvokerTestSuite is a test suite for WasmInvoker
+type WasmInvokerTestSuite struct {
+	suite.Suite
+
+	module string
+}
+
+// SetupTest writes the test module to a file.
+func (suite *WasmInvokerTestSuite) SetupTest() {
+	suite.module = filepath.Join(suite.T().TempDir(), "test.wasm")
+	require.NoError(suite.T(), os.WriteFile(suite.module, testModule, 0o600))
+}
+
+// TestInvokeSuccess tests the success case of running a module with arguments and allowed environment variables
+func (suite *WasmInvokerTestSuite) TestInvokeSuccess() {
+	suite.T().Setenv("SLASHES_WASM_ALLOWED", "miku")
+	suite.T().Setenv("SLASHES_WASM_DENIED", "secret")
+
+	ctx := context.Background()
+	invoker, err := NewWasmInvoker(WasmConfig{Env: []string{"SLASHES_WASM_ALLOWED", "SLASHES_WASM_UNSET"}})
+	require.NoError(suite.T(), err)
+	exitCode, output, err := invoker.Invoke(ctx, suite.module, "hello world", "miku")
+
+	// assert
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), 0, exitCode)
+	assert.Equal(suite.T(), suite.module+"|hello world|miku|SLASHES_WASM_ALLOWED=miku|", strings.ReplaceAll(output, "\x00", "|"))
+}
+
+// TestInvokeFailureExitCode tests the failure case of a module exiting with non-zero code
+func (suite *WasmInvokerTestSuite) TestInvokeFailureExitCode() {
+	ctx := context.Background()
+	invoker, err := NewWasmInvoker(WasmConfig{})
+	require.NoError(suite.T(), err)
+	exitCode, _, err := invoker.Invoke(ctx, suite.module, "x")
+
+	// assert
+	assert.Error(suite.T(), err)
+	assert.Equal(suite.T(), 3, exitCode)
+}
+
+// TestInvokeFailureTimeout tests the failure case of a module that times out
+func (suite *WasmInvokerTestSuite) TestInvokeFailureTimeout() {
+	ctx, cancelFunc := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancelFunc()
+	invoker, err := NewWasmInvoker(WasmConfig{})
+	require.NoError(suite.T(), err)
+	exitCode, output, err := invoker.Invoke(ctx, suite.module, "loop")
+
+	// assert
+	assert.ErrorIs(suite.T(), err, context.DeadlineExceeded)
+	assert.Equal(suite.T(), -1, exitCode)
+	assert.True(suite.T(), strings.HasPrefix(output, suite.module))
+}
+
+// TestInvokeMemoryLimit tests the memory limit of a module
+func (suite *WasmInvokerTestSuite) TestInvokeMemoryLimit() {
+	ctx := context.Background()
+
+	// within the limit
+	invoker, err := NewWasmInvoker(WasmConfig{MemoryLimit: 128 << 20})
+	require.NoError(suite.T(), err)
+	exitCode, _, err := invoker.Invoke(ctx, suite.module, "grow")
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), 0, exitCode)
+
+	// the largest limit
+	invoker, err = NewWasmInvoker(WasmConfig{MemoryLimit: 4 << 30})
+	require.NoError(suite.T(), err)
+	exitCode, _, err = invoker.Invoke(ctx, suite.module, "grow")
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), 0, exitCode)
+
+	// exceeds the limit
+	invoker, err = NewWasmInvoker(WasmConfig{MemoryLimit: 16 << 20})
+	require.NoError(suite.T(), err)
+	exitCode, _, err = invoker.Invoke(ctx, suite.module, "grow")
+	assert.Error(suite.T(), err)
+	assert.Equal(suite.T(), -1, exitCode)
+}
+
+// TestInvokeFailureModule tests the failure case of a module which does not exist
+func (suite *WasmInvokerTestSuite) TestInvokeFailureModule() {
+	ctx := context.Background()
+	invoker, err := NewWasmInvoker(WasmConfig{})
+	require.NoError(suite.T(), err)
+	exitCode, _, err := invoker.Invoke(ctx, filepath.Join(filepath.Dir(suite.module), "non-existent.wasm"))
+
+	// assert
+	assert.Error(suite.T(), err)
+	assert.Equal(suite.T(), -1, exitCode)
+}
+
+// TestWasmMemoryLimit tests validating the memory limit and rounding it up to whole pages
+func TestWasmMemoryLimit(t *testing.T) {
+	cases := []struct {
+		limit uint64
+		pages uint32
+		err   string
+	}{
+		{limit: 0, pages: 0},
+		{limit: 1, pages: 1},
+		{limit: 64 << 10, pages: 1},
+		{limit: 64<<10 + 1, pages: 2},
+		{limit: 4 << 30, pages: 65536},
+		{limit: 4<<30 + 1, err: "memory limit must be at most 4GiB: 4294967297"},
+		{limit: 1 << 48, err: "memory limit must be at most 4GiB: 281474976710656"},
+	}
+	for _, c := range cases {
+		config := WasmConfig{MemoryLimit: c.limit}
+		pages, err := config.memoryLimitPages()
+		_, newErr := NewWasmInvoker(config)
+		if c.err != "" {
+			assert.EqualError(t, err, c.err, c.limit)
+			assert.EqualError(t, newErr, c.err, c.limit)
+			continue
+		}
+		assert.NoError(t, err, c.limit)
+		assert.NoError(t, newErr, c.limit)
+		assert.Equal(t, c.pages, pages, c.limit)
+	}
+}
+
+func TestWasmInvokerTestSuite(t *testing.T) {
+	suite.Run(t, new(WasmInvokerTestSuite))
+}
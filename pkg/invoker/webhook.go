@@ -0,0 +1,140 @@
+package invoker
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	// WebhookTimestampHeader is the header carrying the request timestamp in unix seconds
+	WebhookTimestampHeader = "X-Slashes-Request-Timestamp"
+	// WebhookSignatureHeader is the header carrying the HMAC-SHA256 signature of the request
+	WebhookSignatureHeader = "X-Slashes-Signature"
+	// WebhookMaxResponseSize is the maximum size of the webhook response read, the rest is truncated
+	WebhookMaxResponseSize = 4 << 20
+)
+
+// WebhookRequest is the JSON body posted to the webhook.
+type WebhookRequest struct {
+	// Command is the configured command
+	Command string `json:"command"`
+	// Args is the parsed arguments
+	Args []string `json:"args"`
+	// Slack is the Slack context of the invocation, if any
+	Slack *SlackContext `json:"slack,omitempty"`
+	// Stdin is the standard input of the command, if any
+	Stdin *string `json:"stdin,omitempty"`
+}
+
+// WebhookResponse is the JSON body which the webhook may respond with.
+// Responses in other content types are treated as the output of a successful command.
+type WebhookResponse struct {
+	// ExitCode is the exit code of the command
+	ExitCode int `json:"exit_code"`
+	// Output is the console output of the command
+	Output string `json:"output"`
+}
+
+// WebhookInvoker is an Invoker implementation which delegates the command to an HTTP endpoint.
+type WebhookInvoker struct {
+	// HTTPClient is the http client used to call the webhook
+	HTTPClient *http.Client
+	// URL is the URL of the webhook
+	URL string
+	// Secret is the key for signing the requests, empty means unsigned
+	Secret string
+}
+
+// NewWebhookInvoker returns a new Webhook Invoker instance.
+func NewWebhookInvoker(httpClient *http.Client, url, secret string) Invoker {
+	return &WebhookInvoker{
+		HTTPClient: httpClient,
+		URL:        url,
+		Secret:     secret,
+	}
+}
+
+// Invoke posts the command to the webhook and returns the exit code with console outputs.
+func (i *WebhookInvoker) Invoke(ctx context.Context, command string, args ...string) (int, string, error) {
+	payload := WebhookRequest{Command: command, Args: args}
+	if payload.Args == nil {
+		payload.Args = []string{}
+	}
+	if slackContext, ok := SlackContextFrom(ctx); ok {
+		payload.Slack = &slackContext
+	}
+	if stdin, ok := StdinFrom(ctx); ok {
+		payload.Stdin = &stdin
+	}
+
+	body, err := json.Marshal(&payload)
+	if err != nil {
+		return -1, "", err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, i.URL, bytes.NewReader(body))
+	if err != nil {
+		return -1, "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if i.Secret != "" {
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+		req.Header.Set(WebhookTimestampHeader, timestamp)
+		req.Header.Set(WebhookSignatureHeader, SignWebhook(i.Secret, timestamp, body))
+	}
+
+	res, err := i.HTTPClient.Do(req)
+	if err != nil {
+		return -1, "", err
+	}
+	defer res.Body.Close()
+
+	// one more byte is read to tell the truncated response
+	resBody, err := io.ReadAll(io.LimitReader(res.Body, WebhookMaxResponseSize+1))
+	if err != nil {
+		return -1, "", fmt.Errorf("failed to read webhook response: %w", err)
+	}
+	if len(resBody) > WebhookMaxResponseSize {
+		return -1, string(resBody[:WebhookMaxResponseSize]), fmt.Errorf("webhook response is truncated to %d bytes", WebhookMaxResponseSize)
+	}
+
+	// non-2xx responses are failures of the command
+	if res.StatusCode < http.StatusOK || res.StatusCode >= http.StatusMultipleChoices {
+		return 1, string(resBody), fmt.Errorf("webhook responded with status %s", res.Status)
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(res.Header.Get("Content-Type"))
+	if mediaType != "application/json" {
+		return 0, string(resBody), nil
+	}
+
+	var result WebhookResponse
+	if err := json.Unmarshal(resBody, &result); err != nil {
+		return -1, string(resBody), fmt.Errorf("malformed webhook response: %w", err)
+	}
+	if result.ExitCode != 0 {
+		return result.ExitCode, result.Output, fmt.Errorf("exit status %d", result.ExitCode)
+	}
+
+	return 0, result.Output, nil
+}
+
+// SignWebhook returns the signature of the webhook request, in the form of "v0=" followed by
+// the hex encoded HMAC-SHA256 of "v0:<timestamp>:<body>", the same scheme as Slack request signing.
+func SignWebhook(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte("v0:" + timestamp + ":"))
+	mac.Write(body)
+
+	return "v0=" + hex.EncodeToString(mac.Sum(nil))
+}
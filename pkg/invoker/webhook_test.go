@@ -0,0 +1,185 @@
+package invoker
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+// WebhookInvokerTestSuite is a test suite for WebhookInvoker
+type WebhookInvokerTestSuite struct {
+	suite.Suite
+
+	server  *httptest.Server
+	handler http.HandlerFunc
+	request WebhookRequest
+	signed  bool
+}
+
+// SetupTest starts a webhook server which records the requests and verifies the signatures.
+func (suite *WebhookInvokerTestSuite) SetupTest() {
+	suite.request = WebhookRequest{}
+	suite.signed = false
+	suite.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		timestamp := r.Header.Get(WebhookTimestampHeader)
+		suite.signed = r.Header.Get(WebhookSignatureHeader) == SignWebhook("secret", timestamp, body)
+		if err := json.Unmarshal(body, &suite.request); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		suite.handler(w, r)
+	}))
+}
+
+// TearDownTest stops the webhook server.
+func (suite *WebhookInvokerTestSuite) TearDownTest() {
+	suite.server.Close()
+}
+
+// TestInvokeSuccess tests the success case of invoking a webhook responding with JSON
+func (suite *WebhookInvokerTestSuite) TestInvokeSuccess() {
+	suite.handler = func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		_, _ = w.Write([]byte(`{"exit_code": 0, "output": "deployed"}`))
+	}
+
+	ctx := WithSlackContext(context.Background(), SlackContext{UserID: "U123", UserName: "miku", Text: "deploy api"})
+	invoker := NewWebhookInvoker(http.DefaultClient, suite.server.URL, "secret")
+	exitCode, output, err := invoker.Invoke(ctx, "deploy", "deploy", "api")
+
+	// assert
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), 0, exitCode)
+	assert.Equal(suite.T(), "deployed", output)
+	assert.True(suite.T(), suite.signed)
+	assert.Equal(suite.T(), "deploy", suite.request.Command)
+	assert.Equal(suite.T(), []string{"deploy", "api"}, suite.request.Args)
+	assert.Equal(suite.T(), "U123", suite.request.Slack.UserID)
+	assert.Equal(suite.T(), "deploy api", suite.request.Slack.Text)
+	assert.Nil(suite.T(), suite.request.Stdin)
+}
+
+// TestInvokeStdin tests the success case of invoking a webhook with standard input
+func (suite *WebhookInvokerTestSuite) TestInvokeStdin() {
+	suite.handler = func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("noted"))
+	}
+
+	ctx := WithStdin(context.Background(), "don't forget")
+	invoker := NewWebhookInvoker(http.DefaultClient, suite.server.URL, "secret")
+	exitCode, output, err := invoker.Invoke(ctx, "note")
+
+	// assert
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), 0, exitCode)
+	assert.Equal(suite.T(), "noted", output)
+	assert.Equal(suite.T(), "don't forget", *suite.request.Stdin)
+}
+
+// TestInvokeSuccessText tests the success case of invoking a webhook responding with plain text
+func (suite *WebhookInvokerTestSuite) TestInvokeSuccessText() {
+	suite.handler = func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("hello world"))
+	}
+
+	ctx := context.Background()
+	invoker := NewWebhookInvoker(http.DefaultClient, suite.server.URL, "")
+	exitCode, output, err := invoker.Invoke(ctx, "echo")
+
+	// assert
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), 0, exitCode)
+	assert.Equal(suite.T(), "hello world", output)
+	assert.False(suite.T(), suite.signed)
+	assert.Equal(suite.T(), []string{}, suite.request.Args)
+	assert.Nil(suite.T(), suite.request.Slack)
+}
+
+// TestInvokeFailureExitCode tests the failure case of a webhook responding with non-zero exit code
+func (suite *WebhookInvokerTestSuite) TestInvokeFailureExitCode() {
+	suite.handler = func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"exit_code": 2, "output": "no such service"}`))
+	}
+
+	ctx := context.Background()
+	invoker := NewWebhookInvoker(http.DefaultClient, suite.server.URL, "secret")
+	exitCode, output, err := invoker.Invoke(ctx, "deploy", "unknown")
+
+	// assert
+	assert.Error(suite.T(), err)
+	assert.Equal(suite.T(), 2, exitCode)
+	assert.Equal(suite.T(), "no such service", output)
+}
+
+// TestInvokeFailureStatus tests the failure case of a webhook responding with non-2xx status
+func (suite *WebhookInvokerTestSuite) TestInvokeFailureStatus() {
+	suite.handler = func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+		_, _ = w.Write([]byte("internal error"))
+	}
+
+	ctx := context.Background()
+	invoker := NewWebhookInvoker(http.DefaultClient, suite.server.URL, "secret")
+	exitCode, output, err := invoker.Invoke(ctx, "deploy")
+
+	// assert
+	assert.Error(suite.T(), err)
+	assert.Equal(suite.T(), 1, exitCode)
+	assert.Equal(suite.T(), "internal error", output)
+}
+
+// TestInvokeFailureTooLarge tests the failure case of a webhook responding with the body over the maximum size
+func (suite *WebhookInvokerTestSuite) TestInvokeFailureTooLarge() {
+	suite.handler = func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(bytes.Repeat([]byte("a"), WebhookMaxResponseSize+1))
+	}
+
+	ctx := context.Background()
+	invoker := NewWebhookInvoker(http.DefaultClient, suite.server.URL, "")
+	exitCode, output, err := invoker.Invoke(ctx, "echo")
+
+	// assert
+	assert.EqualError(suite.T(), err, "webhook response is truncated to 4194304 bytes")
+	assert.Equal(suite.T(), -1, exitCode)
+	assert.Len(suite.T(), output, WebhookMaxResponseSize)
+}
+
+// TestInvokeFailureTimeout tests the failure case of a webhook that times out
+func (suite *WebhookInvokerTestSuite) TestInvokeFailureTimeout() {
+	suite.handler = func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(time.Second):
+		}
+	}
+
+	ctx, cancelFunc := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancelFunc()
+	invoker := NewWebhookInvoker(http.DefaultClient, suite.server.URL, "secret")
+	exitCode, output, err := invoker.Invoke(ctx, "deploy")
+
+	// assert
+	assert.ErrorIs(suite.T(), err, context.DeadlineExceeded)
+	assert.Equal(suite.T(), -1, exitCode)
+	assert.Equal(suite.T(), "", output)
+}
+
+func TestWebhookInvokerTestSuite(t *testing.T) {
+	suite.Run(t, new(WebhookInvokerTestSuite))
+}
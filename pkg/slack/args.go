@@ -0,0 +1,87 @@
+package slack
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	shellwords "github.com/mattn/go-shellwords"
+	"github.com/slack-go/slack"
+)
+
+// ArgumentMode is the way the command text is passed to the command
+type ArgumentMode string
+
+const (
+	// ArgumentModeShellwords parses the text as a shell command line, this is the default mode
+	ArgumentModeShellwords ArgumentMode = "shellwords"
+	// ArgumentModeRaw passes the whole text as a single argument, or no argument for the empty text
+	ArgumentModeRaw ArgumentMode = "raw"
+	// ArgumentModeSplit splits the text by whitespaces without interpreting quotes
+	ArgumentModeSplit ArgumentMode = "split"
+	// ArgumentModeStdin passes the whole text on stdin without arguments
+	ArgumentModeStdin ArgumentMode = "stdin"
+	// ArgumentModeJSON passes the whole slash command payload as JSON on stdin without arguments
+	ArgumentModeJSON ArgumentMode = "json"
+)
+
+// ParseArgumentMode parses the argument mode, empty string means the default mode.
+func ParseArgumentMode(s string) (ArgumentMode, error) {
+	switch mode := ArgumentMode(s); mode {
+	case "":
+		return ArgumentModeShellwords, nil
+	case ArgumentModeShellwords, ArgumentModeRaw, ArgumentModeSplit, ArgumentModeStdin, ArgumentModeJSON:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("unknown argument mode: %s", s)
+	}
+}
+
+// parseArgs returns the arguments and the standard input of the command by the argument mode.
+// The standard input is nil if the mode does not use it.
+func parseArgs(mode ArgumentMode, cmd slack.SlashCommand) ([]string, *string, error) {
+	switch mode {
+	case ArgumentModeShellwords, "":
+		args, err := shellwords.Parse(cmd.Text)
+		if err != nil {
+			return nil, nil, fmt.Errorf("malformed argument: %s %w", cmd.Text, err)
+		}
+		return args, nil, nil
+	case ArgumentModeRaw:
+		// no text means no argument instead of an empty one
+		if cmd.Text == "" {
+			return []string{}, nil, nil
+		}
+		return []string{cmd.Text}, nil, nil
+	case ArgumentModeSplit:
+		return strings.Fields(cmd.Text), nil, nil
+	case ArgumentModeStdin:
+		return []string{}, &cmd.Text, nil
+	case ArgumentModeJSON:
+		// never pass the verification token to the command
+		cmd.Token = ""
+		payload, err := json.Marshal(&cmd)
+		if err != nil {
+			return nil, nil, err
+		}
+		stdin := string(payload)
+		return []string{}, &stdin, nil
+	default:
+		return nil, nil, fmt.Errorf("unknown argument mode: %s", mode)
+	}
+}
+
+// shellJoin returns the command line of the arguments quoted as the shell words, which is parsed back by the
+// shellwords mode
+func shellJoin(args []string) string {
+	quoted := make([]string, 0, len(args))
+	for _, arg := range args {
+		if arg != "" && !strings.ContainsAny(arg, " \t\n'\"\\$`;&|<>*?#~()[]{}") {
+			quoted = append(quoted, arg)
+			continue
+		}
+		quoted = append(quoted, "'"+strings.ReplaceAll(arg, "'", `'\''`)+"'")
+	}
+
+	return strings.Join(quoted, " ")
+}
@@ -0,0 +1,86 @@
+package slack
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/slack-go/slack"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestParseArgs tests parsing the command text by the argument modes
+func TestParseArgs(t *testing.T) {
+	cmd := slack.SlashCommand{Token: "testToken", UserName: "miku", Text: `don't  forget "the milk"`}
+
+	cases := []struct {
+		mode  ArgumentMode
+		args  []string
+		stdin string
+		err   bool
+	}{
+		{mode: ArgumentModeShellwords, err: true},
+		{mode: ArgumentModeRaw, args: []string{`don't  forget "the milk"`}},
+		{mode: ArgumentModeSplit, args: []string{"don't", "forget", `"the`, `milk"`}},
+		{mode: ArgumentModeStdin, args: []string{}, stdin: `don't  forget "the milk"`},
+		{mode: "unknown", err: true},
+	}
+
+	for _, c := range cases {
+		args, stdin, err := parseArgs(c.mode, cmd)
+		if c.err {
+			assert.Error(t, err, c.mode)
+			continue
+		}
+
+		assert.NoError(t, err, c.mode)
+		assert.Equal(t, c.args, args, c.mode)
+		if c.stdin == "" {
+			assert.Nil(t, stdin, c.mode)
+		} else {
+			assert.Equal(t, c.stdin, *stdin, c.mode)
+		}
+	}
+
+	// shellwords
+	args, stdin, err := parseArgs(ArgumentModeShellwords, slack.SlashCommand{Text: `deploy "api server" prod`})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"deploy", "api server", "prod"}, args)
+	assert.Nil(t, stdin)
+
+	// shellwords never rejects the formatted references left as is
+	_, _, err = parseArgs(ArgumentModeShellwords, slack.SlashCommand{Text: `deploy <@U123|alice> prod`})
+	assert.NoError(t, err)
+
+	// the empty text is no argument
+	for _, mode := range []ArgumentMode{ArgumentModeShellwords, ArgumentModeRaw, ArgumentModeSplit} {
+		args, stdin, err = parseArgs(mode, slack.SlashCommand{})
+		assert.NoError(t, err, mode)
+		assert.Empty(t, args, mode)
+		assert.Nil(t, stdin, mode)
+	}
+
+	// json
+	args, stdin, err = parseArgs(ArgumentModeJSON, cmd)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{}, args)
+
+	var payload slack.SlashCommand
+	assert.NoError(t, json.Unmarshal([]byte(*stdin), &payload))
+	assert.Equal(t, "miku", payload.UserName)
+	assert.Equal(t, cmd.Text, payload.Text)
+	assert.Empty(t, payload.Token)
+}
+
+// TestParseArgumentMode tests parsing the argument modes
+func TestParseArgumentMode(t *testing.T) {
+	mode, err := ParseArgumentMode("")
+	assert.NoError(t, err)
+	assert.Equal(t, ArgumentModeShellwords, mode)
+
+	mode, err = ParseArgumentMode("stdin")
+	assert.NoError(t, err)
+	assert.Equal(t, ArgumentModeStdin, mode)
+
+	_, err = ParseArgumentMode("unknown")
+	assert.Error(t, err)
+}
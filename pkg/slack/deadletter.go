@@ -0,0 +1,139 @@
+package slack
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"sync"
+	"time"
+)
+
+// DeadLetter is the result of a job which could not be delivered to the user
+type DeadLetter struct {
+	// Time is when the delivery was given up
+	Time time.Time `json:"time"`
+	// JobID is the unique ID of the job
+	JobID string `json:"job_id"`
+	// Command is the slash command (e.g. /deploy)
+	Command string `json:"command"`
+	// Text is the text of the slash command
+	Text string `json:"text"`
+	// UserID is the ID of the user who sent the command
+	UserID string `json:"user_id"`
+	// UserName is the name of the user who sent the command
+	UserName string `json:"user_name"`
+	// ChannelID is the ID of the channel where the command was sent
+	ChannelID string `json:"channel_id"`
+	// ChannelName is the name of the channel where the command was sent
+	ChannelName string `json:"channel_name"`
+	// Outcome is the outcome of the command
+	Outcome Outcome `json:"outcome"`
+	// ExitCode is the exit code of the command
+	ExitCode int `json:"exit_code"`
+	// Output is the output of the command
+	Output string `json:"output"`
+	// Error is the description of the error of the command, empty if no error
+	Error string `json:"error,omitempty"`
+	// DeliveryError is the error of the last delivery
+	DeliveryError string `json:"delivery_error"`
+}
+
+// DeadLetterStore is the store of the results which could not be delivered
+type DeadLetterStore interface {
+	// Store stores the dead letter
+	Store(letter *DeadLetter) error
+	// List returns the dead letters in the stored order
+	List() ([]*DeadLetter, error)
+}
+
+// FileDeadLetterStore is the dead letter store appending the dead letters to a JSON Lines file
+type FileDeadLetterStore struct {
+	path string
+	mu   sync.Mutex
+}
+
+// NewFileDeadLetterStore returns a new FileDeadLetterStore of the file, which is created on the first dead letter.
+func NewFileDeadLetterStore(path string) *FileDeadLetterStore {
+	return &FileDeadLetterStore{path: path}
+}
+
+// Store implements DeadLetterStore.
+func (s *FileDeadLetterStore) Store(letter *DeadLetter) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// the output may contain secrets, the file is readable only by the owner
+	f, err := os.OpenFile(s.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+
+	if err := json.NewEncoder(f).Encode(letter); err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
+
+// List implements DeadLetterStore.
+func (s *FileDeadLetterStore) List() ([]*DeadLetter, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	f, err := os.Open(s.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var letters []*DeadLetter
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		letter := &DeadLetter{}
+		if err := json.Unmarshal(scanner.Bytes(), letter); err != nil {
+			return nil, fmt.Errorf("malformed dead letter at line %d: %w", line, err)
+		}
+		letters = append(letters, letter)
+	}
+
+	return letters, scanner.Err()
+}
+
+// deadLetter logs the result which could not be delivered, and stores it to the dead letter store if set
+func (h *Handler) deadLetter(j *job, r *result, err error) {
+	h.logger.WithError(err).WithField("job", j.id).WithField("user", j.cmd.UserID).WithField("channel", j.cmd.ChannelID).
+		Error("Failed to deliver the result of the command")
+	if h.DeadLetters == nil {
+		return
+	}
+
+	letter := &DeadLetter{
+		Time:          time.Now(),
+		JobID:         j.id,
+		Command:       j.cmd.Command,
+		Text:          j.cmd.Text,
+		UserID:        j.cmd.UserID,
+		UserName:      j.cmd.UserName,
+		ChannelID:     j.cmd.ChannelID,
+		ChannelName:   j.cmd.ChannelName,
+		Outcome:       r.outcome(),
+		ExitCode:      r.exitCode,
+		Output:        r.output,
+		Error:         r.errorMessage(),
+		DeliveryError: err.Error(),
+	}
+	if err := h.DeadLetters.Store(letter); err != nil {
+		h.logger.WithError(err).WithField("job", j.id).Error("Failed to store the dead letter")
+	}
+}
@@ -0,0 +1,70 @@
+package slack
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/slack-go/slack"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestFileDeadLetterStore tests storing and listing the dead letters
+func TestFileDeadLetterStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dead-letters.jsonl")
+	store := NewFileDeadLetterStore(path)
+
+	// no dead letters before the file is created
+	letters, err := store.List()
+	assert.NoError(t, err)
+	assert.Empty(t, letters)
+
+	assert.NoError(t, store.Store(&DeadLetter{JobID: "job1", Output: "line 1\nline 2", DeliveryError: "expired_url"}))
+	assert.NoError(t, store.Store(&DeadLetter{JobID: "job2", Outcome: OutcomeFailure, ExitCode: 1}))
+
+	letters, err = store.List()
+	assert.NoError(t, err)
+	require.Len(t, letters, 2)
+	assert.Equal(t, "job1", letters[0].JobID)
+	assert.Equal(t, "line 1\nline 2", letters[0].Output)
+	assert.Equal(t, "expired_url", letters[0].DeliveryError)
+	assert.Equal(t, OutcomeFailure, letters[1].Outcome)
+
+	info, err := os.Stat(path)
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+}
+
+// TestHandlerDeadLetter tests storing the result which could not be delivered
+func TestHandlerDeadLetter(t *testing.T) {
+	monitor := &monitorTripper{expectedMethod: http.MethodPost, expectedURL: "https://dummy"}
+	logger := logrus.New()
+	logger.SetLevel(logrus.PanicLevel)
+	h := New(nil, &http.Client{Transport: monitor}, logger, "deploy", time.Second, "testToken")
+	h.DeadLetters = NewFileDeadLetterStore(filepath.Join(t.TempDir(), "dead-letters.jsonl"))
+
+	// the response URL is expired
+	j := h.newJob(slack.SlashCommand{Command: "/deploy", Text: "api", UserID: "U123", ResponseURL: "https://dummy"})
+	j.startedAt = time.Now().Add(-responseURLLifetime)
+	r := &result{exitCode: 1, output: "no such service", err: errors.New("exit status 1")}
+	err := h.notifyFinish(j, r)
+	require.Error(t, err)
+	h.deadLetter(j, r, err)
+
+	letters, err := h.DeadLetters.List()
+	assert.NoError(t, err)
+	require.Len(t, letters, 1)
+	assert.Equal(t, j.id, letters[0].JobID)
+	assert.Equal(t, "/deploy", letters[0].Command)
+	assert.Equal(t, "U123", letters[0].UserID)
+	assert.Equal(t, OutcomeFailure, letters[0].Outcome)
+	assert.Equal(t, "no such service", letters[0].Output)
+	assert.Equal(t, "exit status 1", letters[0].Error)
+	assert.Contains(t, letters[0].DeliveryError, "expired")
+	assert.Len(t, monitor.body, 0)
+}
@@ -0,0 +1,222 @@
+package slack
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/labstack/echo/v4"
+	"github.com/sirupsen/logrus"
+	"github.com/slack-go/slack"
+	"github.com/slack-go/slack/slackevents"
+)
+
+// maxRecentEvents is the number of the recent event IDs kept to ignore the events redelivered by slack
+const maxRecentEvents = 1000
+
+// leadingMentionPattern matches the mentions at the beginning of the text of an app mention (e.g. <@U123|slashes>)
+var leadingMentionPattern = regexp.MustCompile(`^\s*(<@[A-Z0-9]+(\|[^>]*)?>\s*)+`)
+
+// EventsHandler is the structure representing the handler of the Events API, which runs the command by the
+// mentions of the bot and the direct messages as the slash commands, and replies in the thread by the Web API
+type EventsHandler struct {
+	// Slash is the slash command handler running the commands, which must have the bot token
+	Slash *Handler
+	// SigningSecret is the signing secret verifying the requests
+	SigningSecret string
+	// Name is the name of the command the messages start with (e.g. deploy for "@slashes deploy api prod"),
+	// the other messages are ignored. Empty means the whole text is the arguments.
+	Name string
+
+	// logger is the logger used to log the events
+	logger *logrus.Logger
+
+	// mu guards the recent event IDs
+	mu sync.Mutex
+	// seen is the recent event IDs
+	seen map[string]bool
+	// order is the recent event IDs in the received order
+	order []string
+}
+
+// NewEventsHandler returns a new EventsHandler of the slash command handler
+func NewEventsHandler(slash *Handler, signingSecret string, logger *logrus.Logger) *EventsHandler {
+	return &EventsHandler{
+		Slash:         slash,
+		SigningSecret: signingSecret,
+
+		logger: logger,
+		seen:   map[string]bool{},
+	}
+}
+
+// Handler is the function that handles the requests of the Events API
+func (h *EventsHandler) Handler() func(c echo.Context) error {
+	return func(c echo.Context) error {
+		body, err := io.ReadAll(c.Request().Body)
+		if err != nil {
+			h.logger.WithError(err).Error("Failed to read the event")
+			return echo.NewHTTPError(http.StatusBadRequest)
+		}
+
+		// Verify the request
+		if err := h.verify(c.Request().Header, body); err != nil {
+			h.logger.WithError(err).Warn("Invalid signature")
+			return echo.NewHTTPError(http.StatusUnauthorized)
+		}
+
+		// Parse the request as an event, the signature is verified instead of the token
+		if !json.Valid(body) {
+			h.logger.Error("Failed to parse the event")
+			return echo.NewHTTPError(http.StatusBadRequest)
+		}
+		event, err := slackevents.ParseEvent(body, slackevents.OptionNoVerifyToken())
+		if err != nil {
+			// the events not subscribed for are acknowledged not to be redelivered
+			h.logger.WithError(err).Info("Ignored the event")
+			return c.NoContent(http.StatusOK)
+		}
+
+		switch event.Type {
+		case slackevents.URLVerification:
+			var challenge slackevents.ChallengeResponse
+			if err := json.Unmarshal(body, &challenge); err != nil {
+				return echo.NewHTTPError(http.StatusBadRequest)
+			}
+			return c.String(http.StatusOK, challenge.Challenge)
+		case slackevents.CallbackEvent:
+			h.dispatch(event)
+		}
+
+		return c.NoContent(http.StatusOK)
+	}
+}
+
+// verify checks the signature of the request by the signing secret
+func (h *EventsHandler) verify(header http.Header, body []byte) error {
+	return verifySignature(header, body, h.SigningSecret)
+}
+
+// verifySignature checks the X-Slack-Signature header of the request body by the signing secret
+func verifySignature(header http.Header, body []byte, signingSecret string) error {
+	if signingSecret == "" {
+		return errors.New("no signing secret")
+	}
+
+	verifier, err := slack.NewSecretsVerifier(header, signingSecret)
+	if err != nil {
+		return err
+	}
+	if _, err := verifier.Write(body); err != nil {
+		return err
+	}
+
+	return verifier.Ensure()
+}
+
+// dispatch runs the command of the app mention or the direct message in background, the other events and the
+// redelivered events are ignored
+func (h *EventsHandler) dispatch(event slackevents.EventsAPIEvent) {
+	if callback, ok := event.Data.(*slackevents.EventsAPICallbackEvent); ok && !h.firstSeen(callback.EventID) {
+		h.logger.WithField("event", callback.EventID).Info("Ignored the redelivered event")
+		return
+	}
+
+	var user, channel, text, ts, threadTS string
+	switch ev := event.InnerEvent.Data.(type) {
+	case *slackevents.AppMentionEvent:
+		if ev.BotID != "" {
+			return
+		}
+		user, channel, ts, threadTS = ev.User, ev.Channel, ev.TimeStamp, ev.ThreadTimeStamp
+		text = leadingMentionPattern.ReplaceAllString(ev.Text, "")
+	case *slackevents.MessageEvent:
+		// the replies of the bot, the edits and the other subtypes are not the commands
+		if ev.ChannelType != "im" || ev.BotID != "" || ev.SubType != "" {
+			return
+		}
+		user, channel, ts, threadTS = ev.User, ev.Channel, ev.TimeStamp, ev.ThreadTimeStamp
+		text = ev.Text
+	default:
+		h.logger.WithField("type", event.InnerEvent.Type).Info("Ignored the event")
+		return
+	}
+
+	text = strings.TrimSpace(text)
+	if h.Name != "" {
+		if fields := strings.Fields(text); len(fields) == 0 || fields[0] != h.Name {
+			h.logger.WithField("channel", channel).WithField("user", user).Info("Ignored the message of the other command")
+			return
+		}
+		text = strings.TrimSpace(strings.TrimPrefix(text, h.Name))
+	}
+
+	// the reply is posted in the thread of the message, or in the thread the message is posted in
+	if threadTS == "" {
+		threadTS = ts
+	}
+	cmd := slack.SlashCommand{
+		TeamID:    event.TeamID,
+		ChannelID: channel,
+		UserID:    user,
+		Command:   h.Name,
+		Text:      text,
+		APIAppID:  event.APIAppID,
+	}
+	go h.Slash.handleMessage(cmd, threadTS)
+}
+
+// firstSeen returns whether the event is received for the first time, empty ID is always the first time
+func (h *EventsHandler) firstSeen(eventID string) bool {
+	if eventID == "" {
+		return true
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.seen[eventID] {
+		return false
+	}
+	h.seen[eventID] = true
+	h.order = append(h.order, eventID)
+	if len(h.order) > maxRecentEvents {
+		delete(h.seen, h.order[0])
+		h.order = h.order[1:]
+	}
+
+	return true
+}
+
+// handleMessage runs the command of the message as the slash command, the messages of the job are posted in the
+// thread of the message by the Web API
+func (h *Handler) handleMessage(cmd slack.SlashCommand, threadTS string) {
+	j := h.newJob(cmd)
+	j.threadTS = threadTS
+
+	// the invalid input is answered with the usage message in the thread
+	if h.Schema != nil && (isHelp(j.args) || j.err != nil) {
+		usage := h.Schema.Usage(cmd.Command)
+		if j.err != nil {
+			h.logger.WithField("command", cmd.Text).WithError(j.err).Info("Invalid arguments")
+			usage = fmt.Sprintf("%s\n\n%s", j.err, usage)
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), notifyTimeout)
+		defer cancel()
+		options := append(msgOptions(usageMessage(usage)), slack.MsgOptionTS(threadTS))
+		if _, _, err := h.postWebAPI(ctx, cmd.ChannelID, options...); err != nil {
+			h.logger.WithError(err).WithField("channel", cmd.ChannelID).Error("Failed to post the usage message")
+		}
+		return
+	}
+
+	h.jobs.add(j)
+	h.start(j)
+}
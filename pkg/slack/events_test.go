@@ -0,0 +1,177 @@
+package slack
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/HatsuneMiku3939/slashes/pkg/invoker"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newEventsHandler returns an events handler replying by the fake slack Web API, the requests of the jobs are sent
+// to the channel
+func newEventsHandler(t *testing.T, api *fakeSlackAPI) (*EventsHandler, chan invoker.Request) {
+	requests := make(chan invoker.Request, 1)
+	funcInvoker := invoker.NewFuncInvoker()
+	funcInvoker.Register("deploy", func(ctx context.Context, req invoker.Request) (invoker.Response, error) {
+		requests <- req
+		return invoker.Response{Output: "deployed " + strings.Join(req.Args, " ")}, nil
+	})
+
+	h, _ := newWebAPIHandler(api, funcInvoker)
+	h.Retry = RetryPolicy{MaxAttempts: 1}
+
+	return NewEventsHandler(h, "testSecret", h.logger), requests
+}
+
+// postEvent sends the event signed by the secret to the handler, and returns the response
+func postEvent(t *testing.T, h *EventsHandler, secret string, event map[string]interface{}) *httptest.ResponseRecorder {
+	body, err := json.Marshal(event)
+	require.NoError(t, err)
+
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(string(body)))
+	req.Header.Set("Content-Type", echo.MIMEApplicationJSON)
+	sign(req, secret, string(body))
+	rec := httptest.NewRecorder()
+
+	if err := h.Handler()(echo.New().NewContext(req, rec)); err != nil {
+		var httpErr *echo.HTTPError
+		require.ErrorAs(t, err, &httpErr)
+		rec.Code = httpErr.Code
+	}
+
+	return rec
+}
+
+// sign sets the signature of the body by the secret to the request
+func sign(req *http.Request, secret string, body string) {
+	timestamp := fmt.Sprint(time.Now().Unix())
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte("v0:" + timestamp + ":" + body))
+	req.Header.Set("X-Slack-Request-Timestamp", timestamp)
+	req.Header.Set("X-Slack-Signature", "v0="+hex.EncodeToString(mac.Sum(nil)))
+}
+
+// callbackEvent returns the event callback of the inner event
+func callbackEvent(eventID string, event map[string]interface{}) map[string]interface{} {
+	return map[string]interface{}{
+		"type":       "event_callback",
+		"team_id":    "T1",
+		"api_app_id": "A1",
+		"event_id":   eventID,
+		"event":      event,
+	}
+}
+
+// waitCalls waits the fake slack Web API receives the number of the calls
+func waitCalls(t *testing.T, api *fakeSlackAPI, n int) []fakeSlackCall {
+	require.Eventually(t, func() bool { return len(api.Calls()) >= n }, 3*time.Second, 10*time.Millisecond)
+	return api.Calls()
+}
+
+// TestEventsVerify tests answering the URL verification and rejecting the unsigned requests
+func TestEventsVerify(t *testing.T) {
+	h, _ := newEventsHandler(t, newFakeSlackAPI(t))
+	challenge := map[string]interface{}{"type": "url_verification", "challenge": "3eZbrw1aBm2rZgRNFdxV2595E9CY3gmdALWMmHkvFXO7tYXAYM8P"}
+
+	rec := postEvent(t, h, "testSecret", challenge)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "3eZbrw1aBm2rZgRNFdxV2595E9CY3gmdALWMmHkvFXO7tYXAYM8P", rec.Body.String())
+
+	assert.Equal(t, http.StatusUnauthorized, postEvent(t, h, "wrongSecret", challenge).Code)
+	h.SigningSecret = ""
+	assert.Equal(t, http.StatusUnauthorized, postEvent(t, h, "", challenge).Code)
+}
+
+// TestEventsAppMention tests running the command by the app mention and replying in the thread
+func TestEventsAppMention(t *testing.T) {
+	api := newFakeSlackAPI(t)
+	h, requests := newEventsHandler(t, api)
+	h.Name = "deploy"
+
+	mention := callbackEvent("Ev1", map[string]interface{}{
+		"type": "app_mention", "user": "U1", "channel": "C1", "ts": "1700000000.000001", "text": "<@UBOT> deploy api  prod",
+	})
+	assert.Equal(t, http.StatusOK, postEvent(t, h, "testSecret", mention).Code)
+
+	req := <-requests
+	assert.Equal(t, []string{"api", "prod"}, req.Args)
+	assert.Equal(t, "U1", req.Slack.UserID)
+	assert.Equal(t, "C1", req.Slack.ChannelID)
+
+	calls := waitCalls(t, api, 2)
+	assert.Equal(t, "chat.postMessage", calls[0].method)
+	assert.Equal(t, "C1", calls[0].form.Get("channel"))
+	assert.Equal(t, "1700000000.000001", calls[0].form.Get("thread_ts"))
+	assert.Equal(t, "chat.update", calls[1].method)
+	assert.Contains(t, calls[1].form.Get("text"), "deployed api prod")
+
+	// the redelivered event is not run again
+	assert.Equal(t, http.StatusOK, postEvent(t, h, "testSecret", mention).Code)
+
+	// the mentions of the other commands are ignored
+	assert.Equal(t, http.StatusOK, postEvent(t, h, "testSecret", callbackEvent("Ev2", map[string]interface{}{
+		"type": "app_mention", "user": "U1", "channel": "C1", "ts": "1700000000.000002", "text": "<@UBOT> rollback api",
+	})).Code)
+
+	time.Sleep(100 * time.Millisecond)
+	assert.Len(t, api.Calls(), 2)
+	assert.Len(t, requests, 0)
+}
+
+// TestEventsDirectMessage tests running the command by the direct message, and ignoring the messages of the bots
+func TestEventsDirectMessage(t *testing.T) {
+	api := newFakeSlackAPI(t)
+	h, requests := newEventsHandler(t, api)
+
+	// the message in the thread is replied in the thread
+	assert.Equal(t, http.StatusOK, postEvent(t, h, "testSecret", callbackEvent("Ev1", map[string]interface{}{
+		"type": "message", "channel_type": "im", "user": "U1", "channel": "D1", "ts": "1700000000.000003", "thread_ts": "1700000000.000001", "text": "api",
+	})).Code)
+	assert.Equal(t, []string{"api"}, (<-requests).Args)
+	calls := waitCalls(t, api, 2)
+	assert.Equal(t, "D1", calls[0].form.Get("channel"))
+	assert.Equal(t, "1700000000.000001", calls[0].form.Get("thread_ts"))
+
+	// the messages of the bots and the messages in the channels are ignored
+	for i, event := range []map[string]interface{}{
+		{"type": "message", "channel_type": "im", "bot_id": "B1", "channel": "D1", "ts": "1700000000.000004", "text": "api"},
+		{"type": "message", "channel_type": "im", "subtype": "message_changed", "channel": "D1", "ts": "1700000000.000005"},
+		{"type": "message", "channel_type": "channel", "user": "U1", "channel": "C1", "ts": "1700000000.000006", "text": "api"},
+	} {
+		assert.Equal(t, http.StatusOK, postEvent(t, h, "testSecret", callbackEvent(fmt.Sprintf("Ev%d", i+2), event)).Code)
+	}
+	time.Sleep(100 * time.Millisecond)
+	assert.Len(t, requests, 0)
+	assert.Len(t, api.Calls(), 2)
+}
+
+// TestEventsUsage tests replying the usage message in the thread for the invalid arguments
+func TestEventsUsage(t *testing.T) {
+	api := newFakeSlackAPI(t)
+	h, requests := newEventsHandler(t, api)
+	h.Name = "deploy"
+	h.Slash.Schema = deploySchema
+
+	assert.Equal(t, http.StatusOK, postEvent(t, h, "testSecret", callbackEvent("Ev1", map[string]interface{}{
+		"type": "app_mention", "user": "U1", "channel": "C1", "ts": "1700000000.000001", "text": "<@UBOT> deploy db",
+	})).Code)
+
+	calls := waitCalls(t, api, 1)
+	assert.Equal(t, "1700000000.000001", calls[0].form.Get("thread_ts"))
+	assert.Contains(t, calls[0].form.Get("text"), "service must be one of api, web")
+	assert.Contains(t, calls[0].form.Get("text"), "Usage: deploy")
+	assert.Len(t, requests, 0)
+}
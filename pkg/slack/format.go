@@ -0,0 +1,100 @@
+package slack
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// ReferenceFormat is how a slack reference such as <@U123|alice> in the command text is decoded
+type ReferenceFormat string
+
+const (
+	// ReferenceFormatRaw keeps the reference as is (e.g. <@U123|alice>), this is the default format
+	ReferenceFormatRaw ReferenceFormat = "raw"
+	// ReferenceFormatID decodes the reference into the ID (e.g. U123), or the URL of a link
+	ReferenceFormatID ReferenceFormat = "id"
+	// ReferenceFormatName decodes the reference into the name (e.g. alice), or the label of a link.
+	// The ID or the URL is used if the reference has no name.
+	ReferenceFormatName ReferenceFormat = "name"
+)
+
+// TextFormat is the configuration of decoding the slack formatting in the command text.
+// The entities (&amp;, &lt; and &gt;) are always unescaped.
+type TextFormat struct {
+	// Users is the format of the user references (e.g. <@U123|alice>)
+	Users ReferenceFormat
+	// Channels is the format of the channel references (e.g. <#C123|general>)
+	Channels ReferenceFormat
+	// Usergroups is the format of the usergroup references (e.g. <!subteam^S123|@team>)
+	Usergroups ReferenceFormat
+	// Links is the format of the links (e.g. <https://example.com|example>)
+	Links ReferenceFormat
+}
+
+// Validate checks the formats of the references.
+func (f *TextFormat) Validate() error {
+	for _, format := range []ReferenceFormat{f.Users, f.Channels, f.Usergroups, f.Links} {
+		switch format {
+		case ReferenceFormatRaw, ReferenceFormatID, ReferenceFormatName, "":
+		default:
+			return fmt.Errorf("unknown reference format: %s", format)
+		}
+	}
+
+	return nil
+}
+
+var (
+	// referencePattern matches the references in the command text
+	referencePattern = regexp.MustCompile(`<([^<>]*)>`)
+	// entityReplacer unescapes the entities escaped by slack
+	entityReplacer = strings.NewReplacer("&lt;", "<", "&gt;", ">", "&amp;", "&")
+)
+
+// Decode returns the plain text of the command text.
+func (f *TextFormat) Decode(text string) string {
+	var b strings.Builder
+
+	last := 0
+	for _, match := range referencePattern.FindAllStringSubmatchIndex(text, -1) {
+		b.WriteString(entityReplacer.Replace(text[last:match[0]]))
+		b.WriteString(f.decodeReference(text[match[0]:match[1]], text[match[2]:match[3]]))
+		last = match[1]
+	}
+	b.WriteString(entityReplacer.Replace(text[last:]))
+
+	return b.String()
+}
+
+// decodeReference returns the plain text of a reference, the content is the reference without the brackets.
+func (f *TextFormat) decodeReference(reference, content string) string {
+	id, name, hasName := strings.Cut(content, "|")
+
+	var format ReferenceFormat
+	switch {
+	case strings.HasPrefix(id, "@"):
+		format, id, name = f.Users, id[1:], strings.TrimPrefix(name, "@")
+	case strings.HasPrefix(id, "#"):
+		format, id, name = f.Channels, id[1:], strings.TrimPrefix(name, "#")
+	case strings.HasPrefix(id, "!subteam^"):
+		format, id, name = f.Usergroups, strings.TrimPrefix(id, "!subteam^"), strings.TrimPrefix(name, "@")
+	case strings.HasPrefix(id, "!"):
+		// special mentions such as <!here> and <!date^...> are kept as is
+		format = ReferenceFormatRaw
+	default:
+		format = f.Links
+	}
+
+	switch format {
+	case ReferenceFormatID:
+		return entityReplacer.Replace(id)
+	case ReferenceFormatName:
+		if !hasName || name == "" {
+			return entityReplacer.Replace(id)
+		}
+		return entityReplacer.Replace(name)
+	default:
+		return entityReplacer.Replace(reference)
+	}
+}
@@ -0,0 +1,40 @@
+package slack
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestTextFormatDecode tests decoding the slack formatting in the command text
+func TestTextFormatDecode(t *testing.T) {
+	text := `deploy "a &amp; b" &lt;tag&gt; <@U123|alice> <@U456> <#C123|general> <!subteam^S123|@team> <https://example.com/?a=1&amp;b=2|example> <!here>`
+
+	cases := []struct {
+		format   TextFormat
+		expected string
+	}{
+		{
+			format:   TextFormat{},
+			expected: `deploy "a & b" <tag> <@U123|alice> <@U456> <#C123|general> <!subteam^S123|@team> <https://example.com/?a=1&b=2|example> <!here>`,
+		},
+		{
+			format:   TextFormat{Users: ReferenceFormatID, Channels: ReferenceFormatID, Usergroups: ReferenceFormatID, Links: ReferenceFormatID},
+			expected: `deploy "a & b" <tag> U123 U456 C123 S123 https://example.com/?a=1&b=2 <!here>`,
+		},
+		{
+			format:   TextFormat{Users: ReferenceFormatName, Channels: ReferenceFormatName, Usergroups: ReferenceFormatName, Links: ReferenceFormatName},
+			expected: `deploy "a & b" <tag> alice U456 general team example <!here>`,
+		},
+	}
+
+	for _, c := range cases {
+		assert.Equal(t, c.expected, c.format.Decode(text), c.format)
+	}
+}
+
+// TestTextFormatValidate tests checking the reference formats
+func TestTextFormatValidate(t *testing.T) {
+	assert.NoError(t, (&TextFormat{Users: ReferenceFormatID, Links: ReferenceFormatName}).Validate())
+	assert.EqualError(t, (&TextFormat{Channels: "mention"}).Validate(), "unknown reference format: mention")
+}
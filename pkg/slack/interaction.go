@@ -0,0 +1,388 @@
+package slack
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/sirupsen/logrus"
+	"github.com/slack-go/slack"
+)
+
+// InteractionHandler is the structure representing the handler of the slack interactions, which are the block
+// actions of the buttons and the menus, the view submissions of the modals, and the shortcuts
+type InteractionHandler struct {
+	// Slash is the slash command handler, whose jobs are rerun, canceled and approved by the built-in actions
+	Slash *Handler
+	// Commands is the filesystem paths of the commands invoked by the action ID of the block actions,
+	// or by the callback ID of the view submissions and the shortcuts
+	Commands map[string]string
+
+	// logger is the logger used to log the events
+	logger *logrus.Logger
+}
+
+// NewInteractionHandler returns a new InteractionHandler of the slash command handler
+func NewInteractionHandler(slash *Handler, logger *logrus.Logger) *InteractionHandler {
+	return &InteractionHandler{
+		Slash:    slash,
+		Commands: map[string]string{},
+
+		logger: logger,
+	}
+}
+
+// Handler is the function that handles the slack interactions
+func (h *InteractionHandler) Handler() func(c echo.Context) error {
+	return func(c echo.Context) error {
+		// Parse and verify the request as a slack interaction
+		callback, payload, err := h.Slash.interaction(c.Request())
+		if err != nil {
+			return err
+		}
+
+		// dispatch the interaction in background, slack waits the acknowledgement only for 3 seconds
+		switch callback.Type {
+		case slack.InteractionTypeBlockActions:
+			for _, action := range callback.ActionCallback.BlockActions {
+				go h.dispatchAction(&callback, action, payload)
+			}
+		case slack.InteractionTypeViewSubmission:
+			// the modal form is validated in the response, the errors are shown in the modal
+			if callback.View.CallbackID == ModalCallbackID {
+				if errs := h.Slash.submitModal(&callback); len(errs) > 0 {
+					return c.JSON(http.StatusOK, slack.NewErrorsViewSubmissionResponse(errs))
+				}
+				break
+			}
+			go h.dispatchCommand(&callback, callback.View.CallbackID, viewArgs(callback.View.State), payload)
+		case slack.InteractionTypeShortcut, slack.InteractionTypeMessageAction:
+			go h.dispatchCommand(&callback, callback.CallbackID, nil, payload)
+		default:
+			h.logger.WithField("type", callback.Type).Info("Ignored the interaction")
+		}
+
+		// sent back an acknowledgement, which closes the modal on the view submission
+		return c.NoContent(http.StatusOK)
+	}
+}
+
+// verifiedKey is the context key marking the requests already verified by the connection, such as the Socket Mode
+// requests
+type verifiedKey struct{}
+
+// interaction parses the payload of the interaction request, which is verified by the signature of the signing secret,
+// or by the verification token when no signing secret is configured. The requests are rejected if neither is
+// configured. The returned error is the HTTP error to respond with.
+func (h *Handler) interaction(req *http.Request) (slack.InteractionCallback, string, error) {
+	var callback slack.InteractionCallback
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		h.logger.WithError(err).Error("Failed to read the interaction")
+		return callback, "", echo.NewHTTPError(http.StatusBadRequest)
+	}
+
+	verified, _ := req.Context().Value(verifiedKey{}).(bool)
+	if !verified && h.SigningSecret != "" {
+		if err := verifySignature(req.Header, body, h.SigningSecret); err != nil {
+			h.logger.WithError(err).Warn("Invalid signature")
+			return callback, "", echo.NewHTTPError(http.StatusUnauthorized)
+		}
+		verified = true
+	}
+
+	// the malformed pairs are skipped as the form parser of echo does
+	values, _ := url.ParseQuery(string(body))
+	payload := values.Get("payload")
+	if err := json.Unmarshal([]byte(payload), &callback); err != nil {
+		h.logger.WithError(err).Error("Failed to parse the interaction")
+		return callback, "", echo.NewHTTPError(http.StatusBadRequest)
+	}
+
+	if !verified && (h.VerificationToken == "" || callback.Token != h.VerificationToken) {
+		h.logger.WithField("type", callback.Type).Warn("Invalid token")
+		return callback, "", echo.NewHTTPError(http.StatusUnauthorized)
+	}
+
+	return callback, payload, nil
+}
+
+// dispatchAction dispatches the block action to the built-in action or the command
+func (h *InteractionHandler) dispatchAction(callback *slack.InteractionCallback, action *slack.BlockAction, payload string) {
+	switch action.ActionID {
+	case ActionRerun, ActionCancel, ActionApprove:
+		h.dispatchJobAction(callback, action)
+	case ActionLog:
+		// the log button opens the URL, nothing to do
+	default:
+		h.dispatchCommand(callback, action.ActionID, []string{actionValue(action)}, payload)
+	}
+}
+
+// dispatchJobAction reruns, cancels or approves the job of the button, the failure is replied to the user
+func (h *InteractionHandler) dispatchJobAction(callback *slack.InteractionCallback, action *slack.BlockAction) {
+	logger := h.logger.WithField("action", action.ActionID).WithField("job", action.Value).WithField("user", callback.User.ID)
+
+	j := h.Slash.jobs.get(action.Value)
+	if j == nil {
+		logger.Warn("Job not found")
+		h.reply(callback, fmt.Sprintf("Job `%s` is not found, it may be too old", escapeText(action.Value)))
+		return
+	}
+
+	var err error
+	switch action.ActionID {
+	case ActionRerun:
+		err = h.Slash.rerun(j, callback.User, callback.ResponseURL)
+	case ActionCancel:
+		err = h.Slash.cancelJob(j, callback.User.ID)
+	case ActionApprove:
+		err = h.Slash.approve(j, callback.User.ID)
+	}
+	if err != nil {
+		logger.WithError(err).Info("Rejected the action")
+		h.reply(callback, err.Error())
+	}
+}
+
+// dispatchCommand invokes the command of the interaction with the arguments and the payload as the standard input,
+// the result is posted to the user
+func (h *InteractionHandler) dispatchCommand(callback *slack.InteractionCallback, id string, args []string, payload string) {
+	command, ok := h.Commands[id]
+	if !ok {
+		h.logger.WithField("type", callback.Type).WithField("id", id).Info("No command for the interaction")
+		return
+	}
+
+	// the interaction is handled as a job of the command
+	j := h.Slash.newInteractionJob(callback, id, command, args, payload)
+	r := h.Slash.invoke(j.ctx, j)
+	h.Slash.logResult(r)
+	if r.outcome() == OutcomeSuccess && strings.TrimSpace(r.output) == "" {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), notifyTimeout)
+	defer cancel()
+
+	msg := h.Slash.renderFinish(j, r)
+	msg.ResponseType = slack.ResponseTypeEphemeral
+	var err error
+	switch {
+	case j.cmd.ResponseURL != "":
+		err = h.Slash.postMessage(ctx, j.cmd.ResponseURL, msg)
+	case h.Slash.useWebAPI():
+		// the modals and the global shortcuts have no response URL, the result is sent by DM
+		_, _, err = h.Slash.postWebAPI(ctx, j.cmd.UserID, msgOptions(msg)...)
+	default:
+		err = errors.New("no response URL of the interaction, and no bot token to send the result by DM")
+	}
+	if err != nil {
+		h.Slash.deadLetter(j, r, err)
+	}
+}
+
+// reply posts the ephemeral message to the user of the interaction, the failure is logged
+func (h *InteractionHandler) reply(callback *slack.InteractionCallback, text string) {
+	if callback.ResponseURL == "" {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), notifyTimeout)
+	defer cancel()
+
+	msg := &slack.Msg{Text: text, ResponseType: slack.ResponseTypeEphemeral}
+	if err := h.Slash.postMessage(ctx, callback.ResponseURL, msg); err != nil {
+		h.logger.WithError(err).Warn("Failed to reply to the interaction")
+	}
+}
+
+// newInteractionJob returns the job of the command invoked by the interaction, the response URL is the first one
+// of the interaction if any
+func (h *Handler) newInteractionJob(callback *slack.InteractionCallback, id string, command string, args []string, payload string) *job {
+	responseURL := callback.ResponseURL
+	if responseURL == "" && len(callback.ResponseURLs) > 0 {
+		responseURL = callback.ResponseURLs[0].ResponseURL
+	}
+
+	cmd := slack.SlashCommand{
+		TeamID:      callback.Team.ID,
+		TeamDomain:  callback.Team.Domain,
+		ChannelID:   callback.Channel.ID,
+		ChannelName: callback.Channel.Name,
+		UserID:      callback.User.ID,
+		UserName:    callback.User.Name,
+		Command:     id,
+		Text:        strings.Join(args, " "),
+		ResponseURL: responseURL,
+		TriggerID:   callback.TriggerID,
+	}
+	j := &job{id: newJobID(), cmd: cmd, command: command, args: args, stdin: &payload, startedAt: time.Now()}
+	j.ctx, j.cancel = context.WithCancel(context.Background())
+
+	return j
+}
+
+// requestApproval posts the message asking the approvers to approve the job
+func (h *Handler) requestApproval(j *job) {
+	ctx, cancel := context.WithTimeout(context.Background(), notifyTimeout)
+	defer cancel()
+
+	if err := h.notify(ctx, j, h.approvalMessage(j), false); err != nil {
+		h.logger.WithError(err).WithField("job", j.id).Error("Failed to request approval")
+	}
+}
+
+// approve runs the job waiting for approval, it returns the reason if the user can not approve the job
+func (h *Handler) approve(j *job, userID string) error {
+	if !h.ApprovalRequired {
+		return errors.New("the job does not require approval")
+	}
+	if !h.canApprove(j, userID) {
+		return errors.New("you are not allowed to approve the job")
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	switch {
+	case j.ctx.Err() != nil:
+		return errors.New("the job is already canceled")
+	case j.approvedBy != "":
+		return fmt.Errorf("the job is already approved by <@%s>", j.approvedBy)
+	}
+	j.approvedBy = userID
+
+	h.logger.WithField("job", j.id).WithField("user", userID).Info("Job approved")
+	go h.handleCommand(j)
+
+	return nil
+}
+
+// canApprove returns whether the user can approve the job, anyone but the requester if no approvers are configured
+func (h *Handler) canApprove(j *job, userID string) bool {
+	if len(h.Approvers) == 0 {
+		return userID != j.cmd.UserID
+	}
+
+	return contains(h.Approvers, userID)
+}
+
+// cancelJob cancels the job requested by the requester or the approvers, it returns the reason if the user can not
+// cancel the job. The result of the job waiting for approval is posted here since the job never runs.
+func (h *Handler) cancelJob(j *job, userID string) error {
+	if !h.canControl(j, userID) {
+		return fmt.Errorf("only <@%s> or the approvers can cancel the job", j.cmd.UserID)
+	}
+
+	j.mu.Lock()
+	pending := h.ApprovalRequired && j.approvedBy == "" && j.ctx.Err() == nil
+	j.cancel()
+	j.mu.Unlock()
+
+	h.logger.WithField("job", j.id).WithField("user", userID).Info("Job canceled")
+	if pending {
+		r := &result{exitCode: -1, err: context.Canceled}
+		if err := h.notifyFinish(j, r); err != nil {
+			h.deadLetter(j, r, err)
+		}
+	}
+
+	return nil
+}
+
+// canControl returns whether the user can cancel or rerun the job, which is the requester or the approvers
+func (h *Handler) canControl(j *job, userID string) bool {
+	return userID == j.cmd.UserID || contains(h.Approvers, userID)
+}
+
+// rerun runs the command of the job again requested by the requester or the approvers, it returns the reason if the
+// user can not rerun the job. The messages are posted to the response URL of the interaction since the response URL
+// of the job may be expired.
+func (h *Handler) rerun(j *job, user slack.User, responseURL string) error {
+	if !h.canControl(j, user.ID) {
+		return fmt.Errorf("only <@%s> or the approvers can rerun the job", j.cmd.UserID)
+	}
+
+	cmd := j.cmd
+	cmd.UserID, cmd.UserName, cmd.ResponseURL = user.ID, user.Name, responseURL
+
+	rerun := h.newJob(cmd)
+	h.jobs.add(rerun)
+	h.logger.WithField("job", rerun.id).WithField("original", j.id).WithField("user", user.ID).Info("Job rerun")
+	h.start(rerun)
+
+	return nil
+}
+
+// actionValue returns the value of the block action, the values of the multi-selects are joined with commas
+func actionValue(action *slack.BlockAction) string {
+	switch {
+	case action.Value != "":
+		return action.Value
+	case action.SelectedOption.Value != "":
+		return action.SelectedOption.Value
+	case action.SelectedDate != "":
+		return action.SelectedDate
+	case action.SelectedTime != "":
+		return action.SelectedTime
+	case action.SelectedUser != "":
+		return action.SelectedUser
+	case action.SelectedChannel != "":
+		return action.SelectedChannel
+	case action.SelectedConversation != "":
+		return action.SelectedConversation
+	case len(action.SelectedOptions) > 0:
+		values := make([]string, 0, len(action.SelectedOptions))
+		for _, option := range action.SelectedOptions {
+			values = append(values, option.Value)
+		}
+		return strings.Join(values, ",")
+	case len(action.SelectedUsers) > 0:
+		return strings.Join(action.SelectedUsers, ",")
+	case len(action.SelectedChannels) > 0:
+		return strings.Join(action.SelectedChannels, ",")
+	default:
+		return strings.Join(action.SelectedConversations, ",")
+	}
+}
+
+// viewArgs returns the values of the view submission as the flags (e.g. --env=prod) named by the action IDs,
+// in the order of the block IDs and the action IDs
+func viewArgs(state *slack.ViewState) []string {
+	if state == nil {
+		return nil
+	}
+
+	type value struct {
+		blockID, actionID, value string
+	}
+	var values []value
+	for blockID, actions := range state.Values {
+		for actionID, action := range actions {
+			action := action
+			values = append(values, value{blockID, actionID, actionValue(&action)})
+		}
+	}
+	sort.Slice(values, func(i, j int) bool {
+		if values[i].blockID != values[j].blockID {
+			return values[i].blockID < values[j].blockID
+		}
+		return values[i].actionID < values[j].actionID
+	})
+
+	args := make([]string, 0, len(values))
+	for _, v := range values {
+		args = append(args, fmt.Sprintf("--%s=%s", v.actionID, v.value))
+	}
+
+	return args
+}
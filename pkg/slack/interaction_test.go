@@ -0,0 +1,315 @@
+package slack
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/HatsuneMiku3939/slashes/pkg/invoker"
+
+	"github.com/labstack/echo/v4"
+	"github.com/sirupsen/logrus"
+	"github.com/slack-go/slack"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// responseRecorder is a local response URL which records the messages
+type responseRecorder struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	messages []string
+}
+
+// newResponseRecorder starts a response recorder, which is closed at the end of the test
+func newResponseRecorder(t *testing.T) *responseRecorder {
+	recorder := &responseRecorder{}
+	recorder.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		recorder.mu.Lock()
+		recorder.messages = append(recorder.messages, string(body))
+		recorder.mu.Unlock()
+	}))
+	t.Cleanup(recorder.Close)
+
+	return recorder
+}
+
+// Messages returns the messages recorded so far
+func (r *responseRecorder) Messages() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return append([]string{}, r.messages...)
+}
+
+// waitMessages waits the recorder receives the number of the messages
+func waitMessages(t *testing.T, recorder *responseRecorder, n int) []string {
+	require.Eventually(t, func() bool { return len(recorder.Messages()) >= n }, 3*time.Second, 10*time.Millisecond)
+	return recorder.Messages()
+}
+
+// newInteractionHandler returns an interaction handler of the slash command handler invoking the functions
+func newInteractionHandler(funcInvoker *invoker.FuncInvoker) *InteractionHandler {
+	logger := logrus.New()
+	logger.SetLevel(logrus.PanicLevel)
+	slash := New(funcInvoker, http.DefaultClient, logger, "deploy", time.Second, "testToken")
+	slash.Retry = RetryPolicy{MaxAttempts: 1}
+
+	return NewInteractionHandler(slash, logger)
+}
+
+// interact sends the interaction payload to the handler, and returns the status code
+func interact(t *testing.T, h *InteractionHandler, callback map[string]interface{}) int {
+	payload, err := json.Marshal(callback)
+	require.NoError(t, err)
+
+	form := make(url.Values)
+	form.Add("payload", string(payload))
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", echo.MIMEApplicationForm)
+	rec := httptest.NewRecorder()
+
+	if err := h.Handler()(echo.New().NewContext(req, rec)); err != nil {
+		var httpErr *echo.HTTPError
+		require.ErrorAs(t, err, &httpErr)
+		return httpErr.Code
+	}
+
+	return rec.Code
+}
+
+// blockAction returns the payload of the block action by the user
+func blockAction(userID string, responseURL string, actionID string, value string) map[string]interface{} {
+	return map[string]interface{}{
+		"type":         "block_actions",
+		"token":        "testToken",
+		"user":         map[string]string{"id": userID, "name": userID},
+		"channel":      map[string]string{"id": "C123"},
+		"response_url": responseURL,
+		"actions":      []map[string]string{{"block_id": "actions", "action_id": actionID, "value": value}},
+	}
+}
+
+// TestInteractionVerify tests rejecting the malformed and the unverified interactions
+func TestInteractionVerify(t *testing.T) {
+	h := newInteractionHandler(invoker.NewFuncInvoker())
+
+	action := blockAction("U1", "", ActionCancel, "job")
+	action["token"] = "wrong"
+	assert.Equal(t, http.StatusUnauthorized, interact(t, h, action))
+
+	form := make(url.Values)
+	form.Add("payload", "{")
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", echo.MIMEApplicationForm)
+	err := h.Handler()(echo.New().NewContext(req, httptest.NewRecorder()))
+	assert.Equal(t, echo.NewHTTPError(http.StatusBadRequest), err)
+}
+
+// TestInteractionSignature tests verifying the interactions by the signing secret, and rejecting them if neither the
+// signing secret nor the verification token is configured
+func TestInteractionSignature(t *testing.T) {
+	h := newInteractionHandler(invoker.NewFuncInvoker())
+	h.Slash.VerificationToken = ""
+
+	send := func(secret string) int {
+		form := make(url.Values)
+		form.Add("payload", `{"type":"unknown"}`)
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", echo.MIMEApplicationForm)
+		if secret != "" {
+			sign(req, secret, form.Encode())
+		}
+		rec := httptest.NewRecorder()
+		if err := h.Handler()(echo.New().NewContext(req, rec)); err != nil {
+			var httpErr *echo.HTTPError
+			require.ErrorAs(t, err, &httpErr)
+			return httpErr.Code
+		}
+		return rec.Code
+	}
+
+	// the payload without the token is not accepted by the empty verification token
+	assert.Equal(t, http.StatusUnauthorized, send(""))
+
+	h.Slash.SigningSecret = "testSecret"
+	assert.Equal(t, http.StatusOK, send("testSecret"))
+	assert.Equal(t, http.StatusUnauthorized, send("wrongSecret"))
+	assert.Equal(t, http.StatusUnauthorized, send(""))
+}
+
+// TestInteractionCancel tests canceling the running job by the cancel button
+func TestInteractionCancel(t *testing.T) {
+	funcInvoker := invoker.NewFuncInvoker()
+	started := make(chan struct{})
+	funcInvoker.Register("deploy", func(ctx context.Context, req invoker.Request) (invoker.Response, error) {
+		close(started)
+		<-ctx.Done()
+		return invoker.Response{}, ctx.Err()
+	})
+	h := newInteractionHandler(funcInvoker)
+	h.Slash.Timeout = 10 * time.Second
+	recorder := newResponseRecorder(t)
+
+	j := h.Slash.newJob(slack.SlashCommand{Command: "/deploy", Text: "api", UserID: "U1", ResponseURL: recorder.URL})
+	h.Slash.jobs.add(j)
+	go h.Slash.handleCommand(j)
+	<-started
+
+	// only the requester or the approvers can cancel
+	assert.Equal(t, http.StatusOK, interact(t, h, blockAction("U2", recorder.URL, ActionCancel, j.id)))
+	messages := waitMessages(t, recorder, 2)
+	assert.Contains(t, messages[1], "only \\u003c@U1\\u003e or the approvers can cancel the job")
+
+	assert.Equal(t, http.StatusOK, interact(t, h, blockAction("U1", recorder.URL, ActionCancel, j.id)))
+	messages = waitMessages(t, recorder, 3)
+	assert.Contains(t, messages[2], "Command canceled")
+}
+
+// TestInteractionApprove tests running the job after approved by the approve button
+func TestInteractionApprove(t *testing.T) {
+	funcInvoker := invoker.NewFuncInvoker()
+	funcInvoker.Register("deploy", func(ctx context.Context, req invoker.Request) (invoker.Response, error) {
+		return invoker.Response{Output: "deployed " + strings.Join(req.Args, " ")}, nil
+	})
+	h := newInteractionHandler(funcInvoker)
+	h.Slash.ApprovalRequired = true
+	recorder := newResponseRecorder(t)
+
+	j := h.Slash.newJob(slack.SlashCommand{Command: "/deploy", Text: "api", UserID: "U1", ResponseURL: recorder.URL})
+	h.Slash.jobs.add(j)
+	h.Slash.requestApproval(j)
+	messages := waitMessages(t, recorder, 1)
+	assert.Contains(t, messages[0], "waiting for approval")
+	assert.Contains(t, messages[0], ActionApprove)
+
+	// the requester can not approve the job
+	interact(t, h, blockAction("U1", recorder.URL, ActionApprove, j.id))
+	messages = waitMessages(t, recorder, 2)
+	assert.Contains(t, messages[1], "you are not allowed to approve the job")
+
+	// the job runs once approved
+	interact(t, h, blockAction("U2", recorder.URL, ActionApprove, j.id))
+	messages = waitMessages(t, recorder, 4)
+	assert.Contains(t, messages[2], "Invoke Command")
+	assert.Contains(t, messages[3], "deployed api")
+
+	// the job is approved only once
+	interact(t, h, blockAction("U3", recorder.URL, ActionApprove, j.id))
+	messages = waitMessages(t, recorder, 5)
+	assert.Contains(t, messages[4], "the job is already approved by \\u003c@U2\\u003e")
+}
+
+// TestInteractionCancelPending tests canceling the job waiting for approval
+func TestInteractionCancelPending(t *testing.T) {
+	h := newInteractionHandler(invoker.NewFuncInvoker())
+	h.Slash.ApprovalRequired = true
+	recorder := newResponseRecorder(t)
+
+	j := h.Slash.newJob(slack.SlashCommand{Command: "/deploy", Text: "api", UserID: "U1", ResponseURL: recorder.URL})
+	h.Slash.jobs.add(j)
+
+	assert.NoError(t, h.Slash.cancelJob(j, "U1"))
+	messages := waitMessages(t, recorder, 1)
+	assert.Contains(t, messages[0], "Command canceled")
+	assert.EqualError(t, h.Slash.approve(j, "U2"), "the job is already canceled")
+}
+
+// TestInteractionRerun tests running the job again by the rerun button
+func TestInteractionRerun(t *testing.T) {
+	funcInvoker := invoker.NewFuncInvoker()
+	var mu sync.Mutex
+	var users []string
+	funcInvoker.Register("deploy", func(ctx context.Context, req invoker.Request) (invoker.Response, error) {
+		mu.Lock()
+		users = append(users, req.Slack.UserID)
+		mu.Unlock()
+		return invoker.Response{Output: "deployed " + strings.Join(req.Args, " ")}, nil
+	})
+	h := newInteractionHandler(funcInvoker)
+	h.Slash.SuppressStart = true
+	recorder := newResponseRecorder(t)
+
+	j := h.Slash.newJob(slack.SlashCommand{Command: "/deploy", Text: "api", UserID: "U1", ResponseURL: "https://expired"})
+	h.Slash.jobs.add(j)
+
+	// the result of the rerun is posted to the response URL of the interaction
+	interact(t, h, blockAction("U1", recorder.URL, ActionRerun, j.id))
+	messages := waitMessages(t, recorder, 1)
+	assert.Contains(t, messages[0], "deployed api")
+
+	// only the requester or the approvers can rerun the job
+	interact(t, h, blockAction("U2", recorder.URL, ActionRerun, j.id))
+	messages = waitMessages(t, recorder, 2)
+	assert.Contains(t, messages[1], "only \\u003c@U1\\u003e or the approvers can rerun the job")
+	h.Slash.Approvers = []string{"U2"}
+	interact(t, h, blockAction("U2", recorder.URL, ActionRerun, j.id))
+	messages = waitMessages(t, recorder, 3)
+	assert.Contains(t, messages[2], "deployed api")
+	mu.Lock()
+	assert.Equal(t, []string{"U1", "U2"}, users)
+	mu.Unlock()
+
+	// the unknown job
+	interact(t, h, blockAction("U2", recorder.URL, ActionRerun, "unknown"))
+	messages = waitMessages(t, recorder, 4)
+	assert.Contains(t, messages[3], "Job `unknown` is not found")
+}
+
+// TestInteractionCommand tests invoking the configured commands by the action ID and the callback ID
+func TestInteractionCommand(t *testing.T) {
+	funcInvoker := invoker.NewFuncInvoker()
+	funcInvoker.Register("rollback", func(ctx context.Context, req invoker.Request) (invoker.Response, error) {
+		payload, _ := invoker.StdinFrom(ctx)
+		var callback slack.InteractionCallback
+		if err := json.Unmarshal([]byte(payload), &callback); err != nil {
+			return invoker.Response{}, err
+		}
+		return invoker.Response{Output: "rollback " + strings.Join(req.Args, " ") + " by " + callback.User.ID}, nil
+	})
+	h := newInteractionHandler(funcInvoker)
+	h.Commands = map[string]string{"rollback_select": "rollback", "rollback_modal": "rollback"}
+	recorder := newResponseRecorder(t)
+
+	// the value of the select is the argument
+	action := blockAction("U1", recorder.URL, "rollback_select", "")
+	action["actions"] = []map[string]interface{}{{"block_id": "actions", "action_id": "rollback_select", "selected_option": map[string]string{"value": "v1.2.3"}}}
+	interact(t, h, action)
+	messages := waitMessages(t, recorder, 1)
+	assert.Contains(t, messages[0], "rollback v1.2.3 by U1")
+
+	// the values of the view submission are the flags
+	interact(t, h, map[string]interface{}{
+		"type":  "view_submission",
+		"token": "testToken",
+		"user":  map[string]string{"id": "U2"},
+		"view": map[string]interface{}{
+			"callback_id": "rollback_modal",
+			"state": map[string]interface{}{"values": map[string]interface{}{
+				"b1": map[string]interface{}{"version": map[string]string{"type": "plain_text_input", "value": "v1.2.2"}},
+				"b2": map[string]interface{}{"env": map[string]interface{}{"type": "static_select", "selected_option": map[string]string{"value": "prod"}}},
+			}},
+		},
+		"response_urls": []map[string]string{{"response_url": recorder.URL}},
+	})
+	messages = waitMessages(t, recorder, 2)
+	assert.Contains(t, messages[1], "rollback --version=v1.2.2 --env=prod by U2")
+}
+
+// TestActionValue tests the values of the block actions
+func TestActionValue(t *testing.T) {
+	assert.Equal(t, "v", actionValue(&slack.BlockAction{Value: "v"}))
+	assert.Equal(t, "2024-01-02", actionValue(&slack.BlockAction{SelectedDate: "2024-01-02"}))
+	assert.Equal(t, "U1", actionValue(&slack.BlockAction{SelectedUser: "U1"}))
+	assert.Equal(t, "a,b", actionValue(&slack.BlockAction{SelectedOptions: []slack.OptionBlockObject{{Value: "a"}, {Value: "b"}}}))
+	assert.Equal(t, "", actionValue(&slack.BlockAction{}))
+}
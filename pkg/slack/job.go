@@ -0,0 +1,176 @@
+package slack
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/HatsuneMiku3939/slashes/pkg/invoker"
+
+	"github.com/slack-go/slack"
+)
+
+// job is a slash command handled by the handler
+type job struct {
+	// id is the unique ID of the job
+	id string
+	// cmd is the slash command
+	cmd slack.SlashCommand
+	// command is the filesystem path of the command to execute
+	command string
+	// args is the arguments passed to the command
+	args []string
+	// stdin is the standard input of the command, nil means no standard input
+	stdin *string
+	// err is the error parsing the arguments, the command is not invoked if set
+	err error
+	// public is whether the user asked to post the result in the channel
+	public bool
+	// startedAt is the time the job was accepted
+	startedAt time.Time
+	// channel is the channel of the message of the job posted by the Web API
+	channel string
+	// ts is the timestamp of the message of the job posted by the Web API, empty if not posted
+	ts string
+	// threadTS is the timestamp of the message the job replies to in the thread, empty for the slash commands
+	threadTS string
+	// responseURLUses is how many times the response URL was used
+	responseURLUses int
+
+	// ctx is the context of the job canceled by the cancel action
+	ctx context.Context
+	// cancel cancels the job
+	cancel context.CancelFunc
+	// mu guards the approval of the job changed by the interactions
+	mu sync.Mutex
+	// approvedBy is the ID of the user who approved the job, empty if not approved
+	approvedBy string
+}
+
+const (
+	// responseURLMaxUses is how many times the response URL of a slash command can be used
+	responseURLMaxUses = 5
+	// responseURLLifetime is how long the response URL of a slash command is valid
+	responseURLLifetime = 30 * time.Minute
+)
+
+// canRespond returns whether the response URL can be used, keeping the reserved uses for the later messages. The jobs
+// triggered by the messages have no response URL.
+// The response URL is taken as expired a notify timeout before its lifetime, not to be expired in flight.
+func (j *job) canRespond(reserved int) bool {
+	if j.cmd.ResponseURL == "" || time.Since(j.startedAt) >= responseURLLifetime-notifyTimeout {
+		return false
+	}
+
+	return j.responseURLUses+reserved < responseURLMaxUses
+}
+
+// newJobID returns a new random job ID
+func newJobID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		// fall back to the time, which is unique enough for the messages
+		return fmt.Sprintf("%016x", time.Now().UnixNano())
+	}
+
+	return hex.EncodeToString(b)
+}
+
+// maxRecentJobs is the number of the recent jobs kept for the interactions
+const maxRecentJobs = 1000
+
+// jobRegistry is the registry of the recent jobs to be rerun, canceled and approved by the interactions
+type jobRegistry struct {
+	mu    sync.Mutex
+	jobs  map[string]*job
+	order []string
+}
+
+// add adds the job, the oldest job is removed if the registry is full
+func (r *jobRegistry) add(j *job) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.jobs == nil {
+		r.jobs = map[string]*job{}
+	}
+	if len(r.order) >= maxRecentJobs {
+		delete(r.jobs, r.order[0])
+		r.order = r.order[1:]
+	}
+	r.jobs[j.id] = j
+	r.order = append(r.order, j.id)
+}
+
+// get returns the job of the ID, nil if not found
+func (r *jobRegistry) get(id string) *job {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.jobs[id]
+}
+
+// Outcome is the outcome of a job
+type Outcome string
+
+const (
+	// OutcomeSuccess is the outcome of a command exited with zero exit code
+	OutcomeSuccess Outcome = "success"
+	// OutcomeFailure is the outcome of a command exited with non-zero exit code
+	OutcomeFailure Outcome = "failure"
+	// OutcomeTimeout is the outcome of a command which did not finish within the timeout
+	OutcomeTimeout Outcome = "timeout"
+	// OutcomeError is the outcome of a command which could not be invoked, or was canceled or killed
+	OutcomeError Outcome = "error"
+)
+
+// result is the result of a job
+type result struct {
+	// exitCode is the exit code of the command
+	exitCode int
+	// output is the output of the command
+	output string
+	// err is the error invoking the command
+	err error
+	// timedOut is whether the command did not finish within the timeout
+	timedOut bool
+	// duration is the time taken by the command
+	duration time.Duration
+}
+
+// outcome returns the outcome of the result
+func (r *result) outcome() Outcome {
+	switch {
+	case r.timedOut:
+		return OutcomeTimeout
+	case r.err != nil && r.exitCode <= 0:
+		return OutcomeError
+	case r.exitCode != 0:
+		return OutcomeFailure
+	default:
+		return OutcomeSuccess
+	}
+}
+
+// errorMessage returns the description of the error, empty string if no error
+func (r *result) errorMessage() string {
+	if r.err == nil {
+		return ""
+	}
+
+	var limitErr *invoker.LimitExceededError
+	switch {
+	case errors.As(r.err, &limitErr):
+		return fmt.Sprintf("Command exceeded the %s limit", limitErr.Resource)
+	case r.timedOut:
+		return "Command timed out"
+	case errors.Is(r.err, context.Canceled):
+		return "Command canceled"
+	default:
+		return r.err.Error()
+	}
+}
@@ -0,0 +1,247 @@
+package slack
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/slack-go/slack"
+)
+
+// ModalCallbackID is the callback ID of the modal form generated from the schema
+const ModalCallbackID = "slashes_modal"
+
+const (
+	// maxModalTitleLength is the maximum length of the modal title
+	maxModalTitleLength = 24
+	// maxLabelLength is the maximum length of the input label
+	maxLabelLength = 2000
+	// argBlockPrefix is the prefix of the block IDs of the positional arguments in the modal form
+	argBlockPrefix = "arg_"
+	// flagBlockPrefix is the prefix of the block IDs of the flags in the modal form
+	flagBlockPrefix = "flag_"
+)
+
+// modalMetadata is the slash command kept in the private metadata of the modal form,
+// so the job of the submission is handled as the slash command
+type modalMetadata struct {
+	TeamID      string `json:"team_id"`
+	TeamDomain  string `json:"team_domain"`
+	ChannelID   string `json:"channel_id"`
+	ChannelName string `json:"channel_name"`
+	Command     string `json:"command"`
+	ResponseURL string `json:"response_url"`
+	RequestedAt int64  `json:"requested_at"`
+}
+
+// useModal returns whether the modal form is opened for the slash command without the text
+func (h *Handler) useModal(cmd slack.SlashCommand) bool {
+	return h.ModalForm && h.useWebAPI() && h.Schema != nil && cmd.TriggerID != "" &&
+		len(h.Schema.Args)+len(h.Schema.Flags) > 0 && strings.TrimSpace(cmd.Text) == ""
+}
+
+// openModal opens the modal form of the schema by views.open, which must be called within 3 seconds of the trigger
+func (h *Handler) openModal(ctx context.Context, cmd slack.SlashCommand) error {
+	view, err := h.modalView(cmd)
+	if err != nil {
+		return err
+	}
+
+	if _, err := h.webAPI().OpenViewContext(ctx, cmd.TriggerID, *view); err != nil {
+		return fmt.Errorf("views.open: %w", err)
+	}
+
+	return nil
+}
+
+// modalView returns the modal form of the schema, the inputs are the enum selects, the date pickers and the
+// text inputs filled with the defaults
+func (h *Handler) modalView(cmd slack.SlashCommand) (*slack.ModalViewRequest, error) {
+	metadata, err := json.Marshal(&modalMetadata{
+		TeamID:      cmd.TeamID,
+		TeamDomain:  cmd.TeamDomain,
+		ChannelID:   cmd.ChannelID,
+		ChannelName: cmd.ChannelName,
+		Command:     cmd.Command,
+		ResponseURL: cmd.ResponseURL,
+		RequestedAt: time.Now().Unix(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var blocks []slack.Block
+	if h.Schema.Description != "" {
+		blocks = append(blocks, slack.NewSectionBlock(slack.NewTextBlockObject(slack.PlainTextType, h.Schema.Description, false, false), nil, nil))
+	}
+	for _, p := range h.Schema.Args {
+		blocks = append(blocks, inputBlock(argBlockPrefix+p.Name, p))
+	}
+	for _, p := range h.Schema.Flags {
+		blocks = append(blocks, inputBlock(flagBlockPrefix+p.Name, p))
+	}
+
+	return &slack.ModalViewRequest{
+		Type:            slack.VTModal,
+		CallbackID:      ModalCallbackID,
+		Title:           slack.NewTextBlockObject(slack.PlainTextType, truncateHead(cmd.Command, maxModalTitleLength), false, false),
+		Submit:          slack.NewTextBlockObject(slack.PlainTextType, "Run", false, false),
+		Close:           slack.NewTextBlockObject(slack.PlainTextType, "Cancel", false, false),
+		Blocks:          slack.Blocks{BlockSet: blocks},
+		PrivateMetadata: string(metadata),
+	}, nil
+}
+
+// inputBlock returns the input of the parameter, the action ID is the name of the parameter
+func inputBlock(blockID string, p Parameter) *slack.InputBlock {
+	var element slack.BlockElement
+	switch {
+	case p.Options != nil:
+		// the options are loaded through the options URL, all of them are listed before typing
+		selectElement := slack.NewOptionsSelectBlockElement(slack.OptTypeExternal, nil, p.Name)
+		minQueryLength := 0
+		selectElement.MinQueryLength = &minQueryLength
+		if p.Default != "" {
+			selectElement.InitialOption = slack.NewOptionBlockObject(p.Default, slack.NewTextBlockObject(slack.PlainTextType, p.Default, false, false), nil)
+		}
+		element = selectElement
+	case p.Type == ParameterTypeEnum:
+		options := make([]*slack.OptionBlockObject, 0, len(p.Values))
+		for _, value := range p.Values {
+			options = append(options, slack.NewOptionBlockObject(value, slack.NewTextBlockObject(slack.PlainTextType, value, false, false), nil))
+		}
+		selectElement := slack.NewOptionsSelectBlockElement(slack.OptTypeStatic, nil, p.Name, options...)
+		for _, option := range options {
+			if option.Value == p.Default {
+				selectElement.InitialOption = option
+			}
+		}
+		element = selectElement
+	case p.Type == ParameterTypeDate:
+		datePicker := slack.NewDatePickerBlockElement(p.Name)
+		datePicker.InitialDate = p.Default
+		element = datePicker
+	default:
+		input := slack.NewPlainTextInputBlockElement(nil, p.Name)
+		input.InitialValue = p.Default
+		if p.Type == ParameterTypeInt || p.Type == ParameterTypeDuration {
+			input.Placeholder = slack.NewTextBlockObject(slack.PlainTextType, string(p.Type), false, false)
+		}
+		element = input
+	}
+
+	var hint *slack.TextBlockObject
+	if p.Description != "" {
+		hint = slack.NewTextBlockObject(slack.PlainTextType, truncateHead(p.Description, maxLabelLength), false, false)
+	}
+	block := slack.NewInputBlock(blockID, slack.NewTextBlockObject(slack.PlainTextType, truncateHead(p.Name, maxLabelLength), false, false), hint, element)
+	block.Optional = !p.Required
+
+	return block
+}
+
+// modalParameter returns the parameter of the input in the modal form by the block ID, nil if not found
+func (h *Handler) modalParameter(blockID string) *Parameter {
+	if h.Schema == nil {
+		return nil
+	}
+
+	for prefix, params := range map[string][]Parameter{argBlockPrefix: h.Schema.Args, flagBlockPrefix: h.Schema.Flags} {
+		for i := range params {
+			if prefix+params[i].Name == blockID {
+				return &params[i]
+			}
+		}
+	}
+
+	return nil
+}
+
+// submitModal validates the values of the submitted modal form, and runs the job of the values. It returns the
+// errors of the inputs by the block IDs shown in the modal form, nil if the job is accepted.
+func (h *Handler) submitModal(callback *slack.InteractionCallback) map[string]string {
+	if h.Schema == nil {
+		return nil
+	}
+
+	var metadata modalMetadata
+	if err := json.Unmarshal([]byte(callback.View.PrivateMetadata), &metadata); err != nil {
+		h.logger.WithError(err).Error("Failed to parse the metadata of the modal")
+		return nil
+	}
+
+	// validate the values by the inputs
+	values := map[string]string{}
+	if callback.View.State != nil {
+		for blockID, actions := range callback.View.State.Values {
+			for _, action := range actions {
+				action := action
+				values[blockID] = actionValue(&action)
+			}
+		}
+	}
+	errs := map[string]string{}
+	var flags, positional []string
+	flagValues := map[string]string{}
+	for _, p := range h.Schema.Flags {
+		if value := values[flagBlockPrefix+p.Name]; value != "" {
+			if err := p.validate(value); err != nil {
+				errs[flagBlockPrefix+p.Name] = err.Error()
+			}
+			flags = append(flags, fmt.Sprintf("--%s=%s", p.Name, value))
+			flagValues[p.Name] = value
+		}
+	}
+	missing := ""
+	for _, p := range h.Schema.Args {
+		value := values[argBlockPrefix+p.Name]
+		if value == "" {
+			value = p.Default
+		}
+		if value == "" {
+			if missing == "" {
+				missing = p.Name
+			}
+			continue
+		}
+		if missing != "" {
+			// the positional arguments after the missing one can not be given
+			errs[argBlockPrefix+missing] = fmt.Sprintf("missing argument: %s, which is required by %s", missing, p.Name)
+			continue
+		}
+		if err := p.validate(value); err != nil {
+			errs[argBlockPrefix+p.Name] = err.Error()
+		}
+		positional = append(positional, value)
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+
+	// the job of the submission is handled as the slash command, the positional arguments are separated from the
+	// flags in the text only if they look like flags
+	args := make([]string, 0, len(flags)+1+len(positional))
+	args = append(append(append(args, flags...), "--"), positional...)
+	text := (&Arguments{Args: positional, Flags: flagValues}).Argv(h.Schema)
+	cmd := slack.SlashCommand{
+		TeamID:      metadata.TeamID,
+		TeamDomain:  metadata.TeamDomain,
+		ChannelID:   metadata.ChannelID,
+		ChannelName: metadata.ChannelName,
+		UserID:      callback.User.ID,
+		UserName:    callback.User.Name,
+		Command:     metadata.Command,
+		Text:        shellJoin(text),
+		ResponseURL: metadata.ResponseURL,
+	}
+	j := &job{id: newJobID(), cmd: cmd, command: h.Command, startedAt: time.Unix(metadata.RequestedAt, 0)}
+	j.ctx, j.cancel = context.WithCancel(context.Background())
+	h.buildArgs(j, args)
+
+	h.jobs.add(j)
+	go h.start(j)
+
+	return nil
+}
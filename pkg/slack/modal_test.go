@@ -0,0 +1,262 @@
+package slack
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/HatsuneMiku3939/slashes/pkg/invoker"
+
+	"github.com/labstack/echo/v4"
+	"github.com/slack-go/slack"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// releaseSchema is the schema of a release command used in the modal tests
+var releaseSchema = &Schema{
+	Description: "Release a service",
+	Args: []Parameter{
+		{Name: "service", Type: ParameterTypeEnum, Values: []string{"api", "web"}, Default: "api", Required: true},
+		{Name: "date", Type: ParameterTypeDate, Description: "release date"},
+		{Name: "note"},
+	},
+	Flags: []Parameter{
+		{Name: "replicas", Type: ParameterTypeInt, Default: "2"},
+	},
+}
+
+// newModalHandler returns a modal form handler posting to the fake slack Web API, the arguments of the jobs are sent
+// to the channel
+func newModalHandler(t *testing.T, api *fakeSlackAPI) (*InteractionHandler, chan []string) {
+	argv := make(chan []string, 1)
+	funcInvoker := invoker.NewFuncInvoker()
+	funcInvoker.Register("deploy", func(ctx context.Context, req invoker.Request) (invoker.Response, error) {
+		argv <- req.Args
+		return invoker.Response{Output: "released"}, nil
+	})
+
+	h, _ := newWebAPIHandler(api, funcInvoker)
+	h.Schema = releaseSchema
+	h.ModalForm = true
+	h.SuppressStart = true
+
+	return NewInteractionHandler(h, h.logger), argv
+}
+
+// submission returns the payload of the modal form submitted with the values by the block IDs
+func submission(t *testing.T, values map[string]interface{}) map[string]interface{} {
+	metadata, err := json.Marshal(&modalMetadata{ChannelID: "C123", Command: "/release", RequestedAt: time.Now().Unix()})
+	require.NoError(t, err)
+
+	state := map[string]interface{}{}
+	for blockID, value := range values {
+		state[blockID] = map[string]interface{}{strings.SplitN(blockID, "_", 2)[1]: value}
+	}
+
+	return map[string]interface{}{
+		"type":  "view_submission",
+		"token": "testToken",
+		"user":  map[string]string{"id": "U1", "name": "miku"},
+		"view": map[string]interface{}{
+			"callback_id":      ModalCallbackID,
+			"private_metadata": string(metadata),
+			"state":            map[string]interface{}{"values": state},
+		},
+	}
+}
+
+// submit sends the submission to the handler, and returns the response body
+func submit(t *testing.T, h *InteractionHandler, callback map[string]interface{}) string {
+	payload, err := json.Marshal(callback)
+	require.NoError(t, err)
+
+	form := make(url.Values)
+	form.Add("payload", string(payload))
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", echo.MIMEApplicationForm)
+	rec := httptest.NewRecorder()
+	require.NoError(t, h.Handler()(echo.New().NewContext(req, rec)))
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	return rec.Body.String()
+}
+
+// TestModalView tests generating the inputs of the modal form from the schema
+func TestModalView(t *testing.T) {
+	h, _ := newModalHandler(t, newFakeSlackAPI(t))
+
+	view, err := h.Slash.modalView(slack.SlashCommand{Command: "/release-a-very-long-command", ChannelID: "C123"})
+	require.NoError(t, err)
+	assert.Equal(t, ModalCallbackID, view.CallbackID)
+	assert.LessOrEqual(t, len([]rune(view.Title.Text)), maxModalTitleLength)
+	require.Len(t, view.Blocks.BlockSet, 5)
+
+	service := view.Blocks.BlockSet[1].(*slack.InputBlock)
+	assert.Equal(t, "arg_service", service.BlockID)
+	assert.False(t, service.Optional)
+	selectElement := service.Element.(*slack.SelectBlockElement)
+	assert.Len(t, selectElement.Options, 2)
+	assert.Equal(t, "api", selectElement.InitialOption.Value)
+
+	date := view.Blocks.BlockSet[2].(*slack.InputBlock)
+	assert.True(t, date.Optional)
+	assert.Equal(t, "release date", date.Hint.Text)
+	assert.IsType(t, &slack.DatePickerBlockElement{}, date.Element)
+
+	replicas := view.Blocks.BlockSet[4].(*slack.InputBlock)
+	assert.Equal(t, "flag_replicas", replicas.BlockID)
+	input := replicas.Element.(*slack.PlainTextInputBlockElement)
+	assert.Equal(t, "2", input.InitialValue)
+	assert.Equal(t, "int", input.Placeholder.Text)
+
+	var metadata modalMetadata
+	require.NoError(t, json.Unmarshal([]byte(view.PrivateMetadata), &metadata))
+	assert.Equal(t, "C123", metadata.ChannelID)
+}
+
+// TestOpenModal tests opening the modal form for the slash command without the text
+func TestOpenModal(t *testing.T) {
+	api := newFakeSlackAPI(t)
+	h, argv := newModalHandler(t, api)
+
+	send := func(text string) string {
+		form := url.Values{"token": {"testToken"}, "command": {"/release"}, "text": {text}, "trigger_id": {"T1"}, "channel_id": {"C123"}}
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", echo.MIMEApplicationForm)
+		rec := httptest.NewRecorder()
+		require.NoError(t, h.Slash.Handler()(echo.New().NewContext(req, rec)))
+		assert.Equal(t, http.StatusOK, rec.Code)
+		return rec.Body.String()
+	}
+
+	assert.Empty(t, send(" "))
+	calls := api.Calls()
+	require.Len(t, calls, 1)
+	assert.Equal(t, "views.open", calls[0].method)
+	assert.Contains(t, calls[0].body, `"trigger_id":"T1"`)
+	assert.Contains(t, calls[0].body, ModalCallbackID)
+
+	// the command line runs the command as before
+	send("web")
+	assert.Equal(t, []string{"--replicas=2", "web"}, <-argv)
+
+	// the command line is used if the modal can not be opened
+	api.mu.Lock()
+	api.failures["views.open"] = "expired_trigger_id"
+	api.mu.Unlock()
+	assert.Contains(t, send(""), "missing argument: service")
+}
+
+// TestSubmitModal tests validating the submitted values and running the job of them
+func TestSubmitModal(t *testing.T) {
+	api := newFakeSlackAPI(t)
+	h, argv := newModalHandler(t, api)
+
+	// the invalid values are shown in the modal
+	body := submit(t, h, submission(t, map[string]interface{}{
+		"arg_date":      map[string]string{"type": "datepicker", "selected_date": "2024-02-30"},
+		"flag_replicas": map[string]string{"type": "plain_text_input", "value": "two"},
+	}))
+	var response slack.ViewSubmissionResponse
+	require.NoError(t, json.Unmarshal([]byte(body), &response))
+	assert.Equal(t, slack.RAErrors, response.ResponseAction)
+	assert.Equal(t, map[string]string{
+		"arg_date":      `date must be a date (e.g. 2024-01-31): "2024-02-30"`,
+		"flag_replicas": `replicas must be an integer: "two"`,
+	}, response.Errors)
+
+	// the valid values run the job, the positional arguments are passed as is
+	assert.Empty(t, submit(t, h, submission(t, map[string]interface{}{
+		"arg_service":   map[string]interface{}{"type": "static_select", "selected_option": map[string]string{"value": "web"}},
+		"arg_date":      map[string]string{"type": "datepicker", "selected_date": "2024-01-31"},
+		"arg_note":      map[string]string{"type": "plain_text_input", "value": "-hotfix 1"},
+		"flag_replicas": map[string]string{"type": "plain_text_input", "value": "3"},
+	})))
+	select {
+	case args := <-argv:
+		assert.Equal(t, []string{"--replicas=3", "--", "web", "2024-01-31", "-hotfix 1"}, args)
+	case <-time.After(3 * time.Second):
+		t.Fatal("the job of the submission did not run")
+	}
+
+	// the job is kept for the interactions with the command line of the values
+	var j *job
+	require.Eventually(t, func() bool {
+		h.Slash.jobs.mu.Lock()
+		defer h.Slash.jobs.mu.Unlock()
+		for _, id := range h.Slash.jobs.order {
+			j = h.Slash.jobs.jobs[id]
+		}
+		return j != nil
+	}, time.Second, 10*time.Millisecond)
+	assert.Equal(t, "U1", j.cmd.UserID)
+	assert.Equal(t, "/release", j.cmd.Command)
+	assert.Equal(t, "--replicas=3 -- web 2024-01-31 '-hotfix 1'", j.cmd.Text)
+	args, _, err := parseArgs(ArgumentModeShellwords, j.cmd)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"--replicas=3", "--", "web", "2024-01-31", "-hotfix 1"}, args)
+}
+
+// TestSubmitModalMissingArgument tests rejecting the submission whose positional argument is missing before the given
+// one, instead of dropping the given one
+func TestSubmitModalMissingArgument(t *testing.T) {
+	api := newFakeSlackAPI(t)
+	h, argv := newModalHandler(t, api)
+
+	body := submit(t, h, submission(t, map[string]interface{}{
+		"arg_note": map[string]string{"type": "plain_text_input", "value": "hotfix"},
+	}))
+	var response slack.ViewSubmissionResponse
+	require.NoError(t, json.Unmarshal([]byte(body), &response))
+	assert.Equal(t, slack.RAErrors, response.ResponseAction)
+	assert.Equal(t, map[string]string{"arg_date": "missing argument: date, which is required by note"}, response.Errors)
+
+	// the trailing optional arguments may be missing
+	assert.Empty(t, submit(t, h, submission(t, map[string]interface{}{})))
+	select {
+	case args := <-argv:
+		assert.Equal(t, []string{"--replicas=2", "api"}, args)
+	case <-time.After(3 * time.Second):
+		t.Fatal("the job of the submission did not run")
+	}
+}
+
+// TestSubmitModalFlags tests running the job of the submission with many flags
+func TestSubmitModalFlags(t *testing.T) {
+	api := newFakeSlackAPI(t)
+	h, argv := newModalHandler(t, api)
+	h.Slash.Schema = &Schema{
+		Args:  []Parameter{{Name: "service"}},
+		Flags: []Parameter{{Name: "a"}, {Name: "b"}, {Name: "c"}, {Name: "d"}, {Name: "e"}},
+	}
+
+	values := map[string]interface{}{"arg_service": map[string]string{"type": "plain_text_input", "value": "web"}}
+	for _, name := range []string{"a", "b", "c", "d", "e"} {
+		values["flag_"+name] = map[string]string{"type": "plain_text_input", "value": name}
+	}
+	assert.Empty(t, submit(t, h, submission(t, values)))
+
+	select {
+	case args := <-argv:
+		assert.Equal(t, []string{"--a=a", "--b=b", "--c=c", "--d=d", "--e=e", "web"}, args)
+	case <-time.After(3 * time.Second):
+		t.Fatal("the job of the submission did not run")
+	}
+}
+
+// TestShellJoin tests quoting the arguments parsed back by the shellwords mode
+func TestShellJoin(t *testing.T) {
+	args := []string{"api", "", "two words", "it's", `"quoted"`, "a|b", "$HOME"}
+	text := shellJoin(args)
+	assert.Equal(t, `api '' 'two words' 'it'\''s' '"quoted"' 'a|b' '$HOME'`, text)
+
+	parsed, _, err := parseArgs(ArgumentModeShellwords, slack.SlashCommand{Text: text})
+	require.NoError(t, err)
+	assert.Equal(t, args, parsed)
+}
@@ -0,0 +1,184 @@
+package slack
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/HatsuneMiku3939/slashes/pkg/invoker"
+
+	"github.com/labstack/echo/v4"
+	"github.com/sirupsen/logrus"
+	"github.com/slack-go/slack"
+)
+
+const (
+	// DefaultOptionsTimeout is the default timeout of loading the options, slack waits the options only for 3 seconds
+	DefaultOptionsTimeout = 2 * time.Second
+	// DefaultOptionsCacheTTL is the default duration the loaded options are reused
+	DefaultOptionsCacheTTL = time.Minute
+
+	// maxOptions is the maximum number of the options of a select menu
+	maxOptions = 100
+	// maxOptionValueLength is the maximum length of the option value
+	maxOptionValueLength = 150
+	// maxOptionTextLength is the maximum length of the option label
+	maxOptionTextLength = 75
+)
+
+// OptionsHandler is the structure representing the handler of the options of the external select menus in the
+// modal form, which are loaded from the option sources of the schema
+type OptionsHandler struct {
+	// Slash is the slash command handler, whose schema declares the option sources
+	Slash *Handler
+	// Invoker is the invoker running the options commands, which is the local host by default instead of the
+	// invoker of the slash commands, since the options are listed by the server on every keystroke
+	Invoker invoker.Invoker
+	// Timeout is the timeout of loading the options
+	Timeout time.Duration
+	// CacheTTL is the duration the loaded options are reused, zero means no cache
+	CacheTTL time.Duration
+
+	// logger is the logger used to log the events
+	logger *logrus.Logger
+
+	// mu guards the cache
+	mu sync.Mutex
+	// cache is the loaded options by the parameter name
+	cache map[string]*cachedOptions
+}
+
+// cachedOptions is the options loaded from the source
+type cachedOptions struct {
+	options  []*slack.OptionBlockObject
+	loadedAt time.Time
+}
+
+// NewOptionsHandler returns a new OptionsHandler of the slash command handler
+func NewOptionsHandler(slash *Handler, logger *logrus.Logger) *OptionsHandler {
+	return &OptionsHandler{
+		Slash:    slash,
+		Invoker:  invoker.NewCmdInvoker(),
+		Timeout:  DefaultOptionsTimeout,
+		CacheTTL: DefaultOptionsCacheTTL,
+
+		logger: logger,
+		cache:  map[string]*cachedOptions{},
+	}
+}
+
+// Handler is the function that handles the block suggestions of the external select menus
+func (h *OptionsHandler) Handler() func(c echo.Context) error {
+	return func(c echo.Context) error {
+		// Parse and verify the request as a block suggestion
+		callback, _, err := h.Slash.interaction(c.Request())
+		if err != nil {
+			return err
+		}
+
+		p := h.Slash.modalParameter(callback.BlockID)
+		if callback.Type != slack.InteractionTypeBlockSuggestion || p == nil || p.Options == nil {
+			h.logger.WithField("type", callback.Type).WithField("block", callback.BlockID).Info("No options for the suggestion")
+			return c.JSON(http.StatusOK, &slack.OptionsResponse{})
+		}
+
+		options, err := h.options(c.Request().Context(), p)
+		if err != nil {
+			h.logger.WithError(err).WithField("parameter", p.Name).Error("Failed to load the options")
+		}
+
+		return c.JSON(http.StatusOK, &slack.OptionsResponse{Options: filterOptions(options, callback.Value)})
+	}
+}
+
+// options returns the options of the parameter from the cache, or loads them from the source. The stale options
+// are returned with the error if the source fails.
+func (h *OptionsHandler) options(ctx context.Context, p *Parameter) ([]*slack.OptionBlockObject, error) {
+	h.mu.Lock()
+	cached := h.cache[p.Name]
+	h.mu.Unlock()
+	if cached != nil && time.Since(cached.loadedAt) < h.CacheTTL {
+		return cached.options, nil
+	}
+
+	options, err := h.load(ctx, p.Options)
+	if err != nil {
+		if cached != nil {
+			return cached.options, err
+		}
+		return nil, err
+	}
+
+	if h.CacheTTL > 0 {
+		h.mu.Lock()
+		h.cache[p.Name] = &cachedOptions{options: options, loadedAt: time.Now()}
+		h.mu.Unlock()
+	}
+
+	return options, nil
+}
+
+// load reads the options from the file, or runs the command printing them within the timeout
+func (h *OptionsHandler) load(ctx context.Context, source *OptionSource) ([]*slack.OptionBlockObject, error) {
+	if source.File != "" {
+		content, err := os.ReadFile(source.File)
+		if err != nil {
+			return nil, err
+		}
+		return parseOptions(string(content)), nil
+	}
+
+	if h.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, h.Timeout)
+		defer cancel()
+	}
+
+	exitCode, output, err := h.Invoker.Invoke(ctx, source.Command)
+	if err != nil {
+		return nil, fmt.Errorf("options command %s: %w", source.Command, err)
+	}
+	if exitCode != 0 {
+		return nil, fmt.Errorf("options command %s exited with %d: %s", source.Command, exitCode, truncateHead(strings.TrimSpace(output), maxOptionTextLength))
+	}
+
+	return parseOptions(output), nil
+}
+
+// parseOptions parses the options listed one per line as value or value<TAB>label, the empty lines are skipped
+func parseOptions(text string) []*slack.OptionBlockObject {
+	var options []*slack.OptionBlockObject
+	for _, line := range strings.Split(text, "\n") {
+		value, label, _ := strings.Cut(strings.TrimRight(line, "\r"), "\t")
+		value = strings.TrimSpace(value)
+		if value == "" || len(value) > maxOptionValueLength {
+			continue
+		}
+		if label = strings.TrimSpace(label); label == "" {
+			label = value
+		}
+		options = append(options, slack.NewOptionBlockObject(value, slack.NewTextBlockObject(slack.PlainTextType, truncateHead(label, maxOptionTextLength), false, false), nil))
+	}
+
+	return options
+}
+
+// filterOptions returns the options whose value or label contains the query case-insensitively, up to the maximum
+func filterOptions(options []*slack.OptionBlockObject, query string) []*slack.OptionBlockObject {
+	query = strings.ToLower(strings.TrimSpace(query))
+	filtered := []*slack.OptionBlockObject{}
+	for _, option := range options {
+		if len(filtered) >= maxOptions {
+			break
+		}
+		if strings.Contains(strings.ToLower(option.Value), query) || strings.Contains(strings.ToLower(option.Text.Text), query) {
+			filtered = append(filtered, option)
+		}
+	}
+
+	return filtered
+}
@@ -0,0 +1,179 @@
+package slack
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/HatsuneMiku3939/slashes/pkg/invoker"
+
+	"github.com/labstack/echo/v4"
+	"github.com/sirupsen/logrus"
+	"github.com/slack-go/slack"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newOptionsHandler returns an options handler of the schema whose service options are listed by the function, the
+// slash commands are never sent to the invoker of the options commands
+func newOptionsHandler(t *testing.T, list invoker.HandlerFunc) *OptionsHandler {
+	envs := filepath.Join(t.TempDir(), "envs")
+	require.NoError(t, os.WriteFile(envs, []byte("staging\tStaging\n\nprod\tProduction\n"), 0600))
+
+	funcInvoker := invoker.NewFuncInvoker()
+	funcInvoker.Register("list-services", list)
+	logger := logrus.New()
+	logger.SetLevel(logrus.PanicLevel)
+	slash := New(invoker.NewFuncInvoker(), http.DefaultClient, logger, "deploy", time.Second, "testToken")
+	slash.Schema = &Schema{
+		Args:  []Parameter{{Name: "service", Options: &OptionSource{Command: "list-services"}}},
+		Flags: []Parameter{{Name: "env", Options: &OptionSource{File: envs}}, {Name: "tag"}},
+	}
+	require.NoError(t, slash.Schema.Validate())
+
+	h := NewOptionsHandler(slash, logger)
+	h.Invoker = funcInvoker
+	return h
+}
+
+// suggest sends the block suggestion to the handler, and returns the values of the options
+func suggest(t *testing.T, h *OptionsHandler, blockID string, query string) []string {
+	payload, err := json.Marshal(map[string]interface{}{
+		"type":      "block_suggestion",
+		"token":     "testToken",
+		"block_id":  blockID,
+		"action_id": strings.SplitN(blockID, "_", 2)[1],
+		"value":     query,
+	})
+	require.NoError(t, err)
+
+	form := make(url.Values)
+	form.Add("payload", string(payload))
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", echo.MIMEApplicationForm)
+	rec := httptest.NewRecorder()
+	require.NoError(t, h.Handler()(echo.New().NewContext(req, rec)))
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var response slack.OptionsResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+	values := []string{}
+	for _, option := range response.Options {
+		values = append(values, option.Value)
+	}
+
+	return values
+}
+
+// TestOptionsHandler tests loading the options from the command and the file, filtered by the query
+func TestOptionsHandler(t *testing.T) {
+	var calls int32
+	h := newOptionsHandler(t, func(ctx context.Context, req invoker.Request) (invoker.Response, error) {
+		atomic.AddInt32(&calls, 1)
+		return invoker.Response{Output: "api\tAPI server\nweb\nworker\n"}, nil
+	})
+
+	assert.Equal(t, []string{"api", "web", "worker"}, suggest(t, h, "arg_service", ""))
+	assert.Equal(t, []string{"api"}, suggest(t, h, "arg_service", "Server"))
+	assert.Equal(t, []string{"web", "worker"}, suggest(t, h, "arg_service", "w"))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls), "the options are cached")
+
+	assert.Equal(t, []string{"prod"}, suggest(t, h, "flag_env", "prod"))
+	assert.Equal(t, []string{}, suggest(t, h, "flag_tag", ""))
+	assert.Equal(t, []string{}, suggest(t, h, "arg_unknown", ""))
+
+	// the options are loaded again after the cache expired
+	h.CacheTTL = 0
+	suggest(t, h, "arg_service", "")
+	suggest(t, h, "arg_service", "")
+	assert.Equal(t, int32(3), atomic.LoadInt32(&calls))
+}
+
+// TestOptionsHandlerFailure tests serving the stale options when the command fails or times out
+func TestOptionsHandlerFailure(t *testing.T) {
+	var fail int32
+	h := newOptionsHandler(t, func(ctx context.Context, req invoker.Request) (invoker.Response, error) {
+		switch atomic.LoadInt32(&fail) {
+		case 1:
+			return invoker.Response{ExitCode: 1, Output: "unavailable"}, nil
+		case 2:
+			<-ctx.Done()
+			return invoker.Response{}, ctx.Err()
+		}
+		return invoker.Response{Output: "api\n"}, nil
+	})
+	h.Timeout = 50 * time.Millisecond
+
+	// no options without the cache
+	atomic.StoreInt32(&fail, 1)
+	assert.Equal(t, []string{}, suggest(t, h, "arg_service", ""))
+	atomic.StoreInt32(&fail, 0)
+	assert.Equal(t, []string{"api"}, suggest(t, h, "arg_service", ""))
+
+	// the stale options are served
+	h.mu.Lock()
+	h.cache["service"].loadedAt = time.Now().Add(-time.Hour)
+	h.mu.Unlock()
+	atomic.StoreInt32(&fail, 2)
+	startedAt := time.Now()
+	assert.Equal(t, []string{"api"}, suggest(t, h, "arg_service", ""))
+	assert.Less(t, time.Since(startedAt), time.Second)
+
+	_, err := h.load(context.Background(), h.Slash.Schema.Args[0].Options)
+	assert.True(t, errors.Is(err, context.DeadlineExceeded), err)
+}
+
+// TestOptionsHandlerLocal tests running the options command on the local host by default, instead of the invoker of
+// the slash commands
+func TestOptionsHandlerLocal(t *testing.T) {
+	list := filepath.Join(t.TempDir(), "list-services")
+	require.NoError(t, os.WriteFile(list, []byte("#!/bin/sh\nprintf 'api\\nweb\\n'\n"), 0700))
+
+	slash := newOptionsHandler(t, nil).Slash
+	slash.Schema.Args[0].Options.Command = list
+	h := NewOptionsHandler(slash, slash.logger)
+
+	assert.Equal(t, []string{"api", "web"}, suggest(t, h, "arg_service", ""))
+}
+
+// TestOptionsHandlerVerify tests rejecting the unverified suggestions
+func TestOptionsHandlerVerify(t *testing.T) {
+	h := newOptionsHandler(t, nil)
+
+	form := make(url.Values)
+	form.Add("payload", `{"type":"block_suggestion","token":"wrong","block_id":"arg_service"}`)
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", echo.MIMEApplicationForm)
+	err := h.Handler()(echo.New().NewContext(req, httptest.NewRecorder()))
+	assert.Equal(t, echo.NewHTTPError(http.StatusUnauthorized), err)
+}
+
+// TestOptionsModal tests the external select menus of the parameters with the option sources
+func TestOptionsModal(t *testing.T) {
+	block := inputBlock("arg_service", Parameter{Name: "service", Default: "api", Options: &OptionSource{Command: "list-services"}})
+	selectElement := block.Element.(*slack.SelectBlockElement)
+	assert.Equal(t, slack.OptTypeExternal, selectElement.Type)
+	assert.Equal(t, 0, *selectElement.MinQueryLength)
+	assert.Equal(t, "api", selectElement.InitialOption.Value)
+}
+
+// TestParseOptions tests parsing the options listed one per line
+func TestParseOptions(t *testing.T) {
+	options := parseOptions("api\tAPI server\r\n  \nweb\t\n" + strings.Repeat("x", maxOptionValueLength+1) + "\n")
+	require.Len(t, options, 2)
+	assert.Equal(t, "api", options[0].Value)
+	assert.Equal(t, "API server", options[0].Text.Text)
+	assert.Equal(t, "web", options[1].Text.Text)
+
+	many := strings.Repeat("option\n", maxOptions+1)
+	assert.Len(t, filterOptions(parseOptions(many), ""), maxOptions)
+}
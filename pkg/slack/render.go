@@ -0,0 +1,364 @@
+package slack
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/slack-go/slack"
+)
+
+// MessageFormat is the format of the messages posted to slack
+type MessageFormat string
+
+const (
+	// MessageFormatCode posts the messages as plain text in a code block, this is the default format
+	MessageFormatCode MessageFormat = "code"
+	// MessageFormatBlocks posts the messages as Block Kit blocks with a header, a status line and buttons
+	MessageFormatBlocks MessageFormat = "blocks"
+)
+
+// ParseMessageFormat parses the message format, empty string means the default format.
+func ParseMessageFormat(s string) (MessageFormat, error) {
+	switch format := MessageFormat(s); format {
+	case "":
+		return MessageFormatCode, nil
+	case MessageFormatCode, MessageFormatBlocks:
+		return format, nil
+	default:
+		return "", fmt.Errorf("unknown message format: %s", s)
+	}
+}
+
+// ParseResponseType parses the response type of the messages, ephemeral or in_channel.
+func ParseResponseType(s string) (string, error) {
+	switch s {
+	case slack.ResponseTypeEphemeral, slack.ResponseTypeInChannel:
+		return s, nil
+	default:
+		return "", fmt.Errorf("unknown response type: %s", s)
+	}
+}
+
+// Button is a button attached to the messages in the blocks format
+type Button string
+
+const (
+	// ButtonRerun is the button to run the command again with the same arguments, attached to the result
+	ButtonRerun Button = "rerun"
+	// ButtonCancel is the button to cancel the running command, attached to the start notice
+	ButtonCancel Button = "cancel"
+	// ButtonLog is the button to open the full log at LogURL, attached to the result
+	ButtonLog Button = "log"
+)
+
+// ParseButton parses the button.
+func ParseButton(s string) (Button, error) {
+	switch button := Button(s); button {
+	case ButtonRerun, ButtonCancel, ButtonLog:
+		return button, nil
+	default:
+		return "", fmt.Errorf("unknown button: %s", s)
+	}
+}
+
+const (
+	// ActionRerun is the action ID of the rerun button, the value is the job ID
+	ActionRerun = "slashes_rerun"
+	// ActionCancel is the action ID of the cancel button, the value is the job ID
+	ActionCancel = "slashes_cancel"
+	// ActionLog is the action ID of the log button
+	ActionLog = "slashes_log"
+	// ActionApprove is the action ID of the approve button of the job waiting for approval, the value is the job ID
+	ActionApprove = "slashes_approve"
+)
+
+const (
+	// maxHeaderLength is the maximum length of the header block text
+	maxHeaderLength = 150
+	// maxSectionLength is the maximum length of the section block text
+	maxSectionLength = 3000
+)
+
+// MessageData is the data of the message templates
+type MessageData struct {
+	// JobID is the unique ID of the job
+	JobID string
+	// Command is the slash command (e.g. /deploy)
+	Command string
+	// Text is the text of the slash command
+	Text string
+	// UserID is the ID of the user who sent the command
+	UserID string
+	// UserName is the name of the user who sent the command
+	UserName string
+	// ChannelID is the ID of the channel where the command was sent
+	ChannelID string
+	// ChannelName is the name of the channel where the command was sent
+	ChannelName string
+	// Timeout is the timeout of the command
+	Timeout time.Duration
+
+	// Outcome is the outcome of the command, empty before the command is finished
+	Outcome Outcome
+	// ExitCode is the exit code of the command
+	ExitCode int
+	// Output is the output of the command
+	Output string
+	// Error is the description of the error, empty if no error
+	Error string
+	// Duration is the time taken by the command
+	Duration time.Duration
+}
+
+// newMessageData returns the data of the message templates, the result is nil before the command is finished.
+func (h *Handler) newMessageData(j *job, r *result) *MessageData {
+	data := &MessageData{
+		JobID:       j.id,
+		Command:     j.cmd.Command,
+		Text:        j.cmd.Text,
+		UserID:      j.cmd.UserID,
+		UserName:    j.cmd.UserName,
+		ChannelID:   j.cmd.ChannelID,
+		ChannelName: j.cmd.ChannelName,
+		Timeout:     h.Timeout,
+	}
+	if r != nil {
+		data.Outcome = r.outcome()
+		data.ExitCode = r.exitCode
+		data.Output = r.output
+		data.Error = r.errorMessage()
+		data.Duration = r.duration
+	}
+
+	return data
+}
+
+// startMessage returns the message notifying the command is being handled
+func (h *Handler) startMessage(j *job) *slack.Msg {
+	msg := h.renderStart(j)
+	msg.ResponseType = h.StartResponseType
+
+	return msg
+}
+
+// finishMessage returns the message notifying the command is finished. The result is posted in the channel
+// if the user asked, or by the response type of the message payload emitted by the command or the handler.
+func (h *Handler) finishMessage(j *job, r *result) *slack.Msg {
+	msg := h.renderFinish(j, r)
+	switch {
+	case j.public:
+		msg.ResponseType = slack.ResponseTypeInChannel
+	case msg.ResponseType == "":
+		msg.ResponseType = h.FinishResponseType
+	}
+	msg.ReplaceOriginal = h.ReplaceOriginal
+
+	return msg
+}
+
+// approvalMessage returns the message asking the approvers to approve the job, which is posted in the channel
+// with the approve and cancel buttons whatever the message format is
+func (h *Handler) approvalMessage(j *job) *slack.Msg {
+	approve := slack.NewButtonBlockElement(ActionApprove, j.id, slack.NewTextBlockObject(slack.PlainTextType, "Approve", false, false))
+	approve.Style = slack.StylePrimary
+	cancel := slack.NewButtonBlockElement(ActionCancel, j.id, slack.NewTextBlockObject(slack.PlainTextType, "Cancel", false, false))
+	cancel.Style = slack.StyleDanger
+
+	blocks := append(headerBlocks(j, fmt.Sprintf("Timeout %s", h.Timeout)),
+		slack.NewContextBlock("status", slack.NewTextBlockObject(slack.MarkdownType, ":raised_hand: Waiting for approval", false, false)),
+		slack.NewActionBlock("actions", approve, cancel))
+
+	return &slack.Msg{
+		Text:         fmt.Sprintf("<@%s> requests to run `%s`, waiting for approval", j.cmd.UserID, escapeText(strings.TrimSpace(j.cmd.Command+" "+j.cmd.Text))),
+		Blocks:       slack.Blocks{BlockSet: blocks},
+		ResponseType: slack.ResponseTypeInChannel,
+	}
+}
+
+// renderStart renders the start notice by the template or the message format
+func (h *Handler) renderStart(j *job) *slack.Msg {
+	if msg := h.renderTemplate(h.Templates.Start, h.newMessageData(j, nil)); msg != nil {
+		return msg
+	}
+
+	text := fmt.Sprintf("Invoke Command with %s timeout...\n$ %s %s", h.Timeout, h.Command, j.cmd.Text)
+	if h.MessageFormat != MessageFormatBlocks {
+		return codeMessage(text)
+	}
+
+	blocks := append(headerBlocks(j, fmt.Sprintf("Timeout %s", h.Timeout)),
+		slack.NewContextBlock("status", slack.NewTextBlockObject(slack.MarkdownType, ":hourglass_flowing_sand: Running", false, false)))
+	if h.hasButton(ButtonCancel) {
+		cancel := slack.NewButtonBlockElement(ActionCancel, j.id, slack.NewTextBlockObject(slack.PlainTextType, "Cancel", false, false))
+		cancel.Style = slack.StyleDanger
+		blocks = append(blocks, slack.NewActionBlock("actions", cancel))
+	}
+
+	return &slack.Msg{
+		Text:   text,
+		Blocks: slack.Blocks{BlockSet: blocks},
+	}
+}
+
+// renderFinish renders the result by the output protocol, the template or the message format
+func (h *Handler) renderFinish(j *job, r *result) *slack.Msg {
+	// the output of the successful command may be a message payload
+	if r.outcome() == OutcomeSuccess {
+		msg, err := parseMessagePayload(h.OutputProtocol, r.output)
+		if err != nil {
+			// fall back to the plain output with the reason
+			h.logger.WithError(err).WithField("job", j.id).Warn("Failed to parse the message payload")
+			fallback := *r
+			fallback.output = fmt.Sprintf("%s\n\n%s", r.output, err)
+			r = &fallback
+		} else if msg != nil {
+			return msg
+		}
+	}
+
+	if msg := h.renderTemplate(h.Templates.result(r.outcome()), h.newMessageData(j, r)); msg != nil {
+		return msg
+	}
+
+	// the status line of the result
+	status := fmt.Sprintf("Exit code: %d", r.exitCode)
+	if errMessage := r.errorMessage(); errMessage != "" {
+		status = fmt.Sprintf("%s\n%s", errMessage, status)
+	}
+
+	if h.MessageFormat != MessageFormatBlocks {
+		if r.outcome() == OutcomeSuccess {
+			return codeMessage(r.output)
+		}
+		return codeMessage(fmt.Sprintf("%s\n\n%s", r.output, status))
+	}
+
+	emoji, color := outcomeStyle(r.outcome())
+	blocks := append(headerBlocks(j, fmt.Sprintf("Took %s", r.duration.Round(time.Millisecond))),
+		slack.NewContextBlock("status", slack.NewTextBlockObject(slack.MarkdownType,
+			fmt.Sprintf("%s %s", emoji, escapeText(strings.ReplaceAll(status, "\n", " / "))), false, false)))
+	if output := strings.TrimSpace(r.output); output != "" {
+		blocks = append(blocks, slack.NewSectionBlock(slack.NewTextBlockObject(slack.MarkdownType, codeBlock(output, maxSectionLength), false, false), nil, nil))
+	}
+
+	var buttons []slack.BlockElement
+	if h.hasButton(ButtonRerun) {
+		buttons = append(buttons, slack.NewButtonBlockElement(ActionRerun, j.id, slack.NewTextBlockObject(slack.PlainTextType, "Rerun", false, false)))
+	}
+	if h.hasButton(ButtonLog) && h.LogURL != nil {
+		var logURL strings.Builder
+		if err := h.LogURL.Execute(&logURL, h.newMessageData(j, r)); err != nil {
+			h.logger.WithError(err).Warn("Failed to render the log URL")
+		} else {
+			log := slack.NewButtonBlockElement(ActionLog, j.id, slack.NewTextBlockObject(slack.PlainTextType, "View full log", false, false))
+			log.URL = logURL.String()
+			buttons = append(buttons, log)
+		}
+	}
+	if len(buttons) > 0 {
+		blocks = append(blocks, slack.NewActionBlock("actions", buttons...))
+	}
+
+	return &slack.Msg{
+		Text: fmt.Sprintf("%s %s", emoji, status),
+		Attachments: []slack.Attachment{{
+			Color:  color,
+			Blocks: slack.Blocks{BlockSet: blocks},
+		}},
+	}
+}
+
+// outcomeStyle returns the emoji and the attachment color of the outcome
+func outcomeStyle(outcome Outcome) (string, string) {
+	switch outcome {
+	case OutcomeSuccess:
+		return ":white_check_mark:", "good"
+	case OutcomeFailure:
+		return ":x:", "danger"
+	default:
+		return ":warning:", "warning"
+	}
+}
+
+// renderTemplate returns the message rendered by the template, nil if the template is nil or fails
+func (h *Handler) renderTemplate(t *template.Template, data *MessageData) *slack.Msg {
+	if t == nil {
+		return nil
+	}
+
+	var text strings.Builder
+	if err := t.Execute(&text, data); err != nil {
+		h.logger.WithError(err).WithField("template", t.Name()).Warn("Failed to render the message template")
+		return nil
+	}
+
+	return &slack.Msg{Text: text.String()}
+}
+
+// hasButton returns whether the button is enabled
+func (h *Handler) hasButton(button Button) bool {
+	for _, b := range h.Buttons {
+		if b == button {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ParseLogURL parses the template of the log URL, which is executed with MessageData
+// (e.g. https://logs.example.com/jobs/{{.JobID}}).
+func ParseLogURL(s string) (*template.Template, error) {
+	return template.New("log_url").Parse(s)
+}
+
+// headerBlocks returns the header of the job with the command, the requester, the job ID and the detail
+func headerBlocks(j *job, detail string) []slack.Block {
+	title := truncateHead(strings.TrimSpace(fmt.Sprintf("%s %s", j.cmd.Command, j.cmd.Text)), maxHeaderLength)
+	context := fmt.Sprintf("Requested by <@%s> | Job `%s` | %s", j.cmd.UserID, j.id, detail)
+
+	return []slack.Block{
+		slack.NewHeaderBlock(slack.NewTextBlockObject(slack.PlainTextType, title, false, false)),
+		slack.NewContextBlock("header", slack.NewTextBlockObject(slack.MarkdownType, context, false, false)),
+	}
+}
+
+// codeMessage returns the message of the text in a code block
+func codeMessage(text string) *slack.Msg {
+	return &slack.Msg{
+		Text: fmt.Sprintf("```\n%s\n```", text),
+	}
+}
+
+// codeBlock returns the escaped text in a code block within the maximum length, the tail of the text is kept
+func codeBlock(text string, maxLength int) string {
+	const fence = "```\n%s\n```"
+	return fmt.Sprintf(fence, truncateTail(escapeText(text), maxLength-len(fence)+2))
+}
+
+// escapeText escapes the control characters of the slack formatting
+func escapeText(text string) string {
+	return strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace(text)
+}
+
+// truncateHead returns the head of the text within the maximum number of characters
+func truncateHead(text string, maxLength int) string {
+	runes := []rune(text)
+	if len(runes) <= maxLength {
+		return text
+	}
+
+	return string(runes[:maxLength-3]) + "..."
+}
+
+// truncateTail returns the tail of the text within the maximum number of characters
+func truncateTail(text string, maxLength int) string {
+	runes := []rune(text)
+	if len(runes) <= maxLength {
+		return text
+	}
+
+	return "..." + string(runes[len(runes)-maxLength+3:])
+}
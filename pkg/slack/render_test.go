@@ -0,0 +1,160 @@
+package slack
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/slack-go/slack"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestFinishMessageCode tests rendering the results in the code format
+func TestFinishMessageCode(t *testing.T) {
+	h := &Handler{MessageFormat: MessageFormatCode, FinishResponseType: slack.ResponseTypeEphemeral, logger: logrus.New()}
+	j := &job{id: "0123456789abcdef", cmd: slack.SlashCommand{Command: "/deploy", Text: "api"}}
+
+	msg := h.finishMessage(j, &result{exitCode: 0, output: "deployed"})
+	assert.Equal(t, "```\ndeployed\n```", msg.Text)
+	assert.Equal(t, slack.ResponseTypeEphemeral, msg.ResponseType)
+
+	msg = h.finishMessage(j, &result{exitCode: 2, output: "no such service", err: errors.New("exit status 2")})
+	assert.Equal(t, "```\nno such service\n\nexit status 2\nExit code: 2\n```", msg.Text)
+
+	msg = h.finishMessage(j, &result{exitCode: -1, output: "partial", err: errors.New("signal: killed"), timedOut: true})
+	assert.Equal(t, "```\npartial\n\nCommand timed out\nExit code: -1\n```", msg.Text)
+}
+
+// TestFinishMessagePayload tests posting the message payload emitted by the command
+func TestFinishMessagePayload(t *testing.T) {
+	h := &Handler{MessageFormat: MessageFormatCode, OutputProtocol: OutputProtocolJSON, logger: logrus.New()}
+	h.logger.SetLevel(logrus.PanicLevel)
+	j := &job{id: "0123456789abcdef", cmd: slack.SlashCommand{Command: "/deploy", Text: "api"}}
+
+	msg := h.finishMessage(j, &result{exitCode: 0, output: `{"text": "*deployed*", "response_type": "in_channel"}`})
+	assert.Equal(t, "*deployed*", msg.Text)
+	assert.Equal(t, slack.ResponseTypeInChannel, msg.ResponseType)
+
+	// fall back to the plain output on the malformed payload
+	msg = h.finishMessage(j, &result{exitCode: 0, output: `{"text": "*deployed*"`})
+	assert.Equal(t, "```\n{\"text\": \"*deployed*\"\n\nmalformed message payload: unexpected EOF\n```", msg.Text)
+
+	// the output of the failed command is never a payload
+	msg = h.finishMessage(j, &result{exitCode: 1, output: `{"text": "*deployed*"}`, err: errors.New("exit status 1")})
+	assert.Contains(t, msg.Text, "Exit code: 1")
+}
+
+// TestFinishMessageResponseType tests choosing the response type of the result
+func TestFinishMessageResponseType(t *testing.T) {
+	h := &Handler{MessageFormat: MessageFormatCode, OutputProtocol: OutputProtocolJSON, FinishResponseType: slack.ResponseTypeEphemeral, ReplaceOriginal: true, logger: logrus.New()}
+	j := &job{id: "0123456789abcdef", cmd: slack.SlashCommand{Command: "/deploy", Text: "api"}}
+
+	// the default of the handler
+	msg := h.finishMessage(j, &result{exitCode: 0, output: "deployed"})
+	assert.Equal(t, slack.ResponseTypeEphemeral, msg.ResponseType)
+	assert.True(t, msg.ReplaceOriginal)
+
+	// the message payload emitted by the command
+	msg = h.finishMessage(j, &result{exitCode: 0, output: `{"text": "deployed", "response_type": "in_channel"}`})
+	assert.Equal(t, slack.ResponseTypeInChannel, msg.ResponseType)
+
+	// the user asked to post the result in the channel
+	j.public = true
+	msg = h.finishMessage(j, &result{exitCode: 0, output: `{"text": "deployed", "response_type": "ephemeral"}`})
+	assert.Equal(t, slack.ResponseTypeInChannel, msg.ResponseType)
+}
+
+// TestCutFlag tests removing the public flag from the text
+func TestCutFlag(t *testing.T) {
+	cases := []struct {
+		text     string
+		expected string
+		found    bool
+	}{
+		{text: "--public deploy api", expected: "deploy api", found: true},
+		{text: "deploy api  --public ", expected: "deploy api", found: true},
+		{text: "--public", expected: "", found: true},
+		{text: "deploy --public api", expected: "deploy --public api"},
+		{text: "deploy api --publicity", expected: "deploy api --publicity"},
+	}
+
+	for _, c := range cases {
+		text, found := cutFlag(c.text, "--public")
+		assert.Equal(t, c.expected, text, c.text)
+		assert.Equal(t, c.found, found, c.text)
+	}
+
+	text, found := cutFlag("--public deploy", "")
+	assert.Equal(t, "--public deploy", text)
+	assert.False(t, found)
+}
+
+// TestFinishMessageBlocks tests rendering the results in the blocks format
+func TestFinishMessageBlocks(t *testing.T) {
+	logURL, err := ParseLogURL("https://logs.example.com/jobs/{{.JobID}}")
+	assert.NoError(t, err)
+
+	h := &Handler{MessageFormat: MessageFormatBlocks, Buttons: []Button{ButtonRerun, ButtonLog}, LogURL: logURL, logger: logrus.New()}
+	j := &job{id: "0123456789abcdef", cmd: slack.SlashCommand{Command: "/deploy", Text: "api", UserID: "U123"}}
+	msg := h.finishMessage(j, &result{exitCode: 1, output: "<no such service>", err: errors.New("exit status 1"), duration: 1234 * time.Millisecond})
+
+	// assert
+	assert.Equal(t, ":x: exit status 1\nExit code: 1", msg.Text)
+	assert.Len(t, msg.Attachments, 1)
+	assert.Equal(t, "danger", msg.Attachments[0].Color)
+
+	payload, err := json.Marshal(msg)
+	assert.NoError(t, err)
+	body := string(payload)
+	assert.Contains(t, body, `{"type":"header","text":{"type":"plain_text","text":"/deploy api"}}`)
+	assert.Contains(t, body, "Requested by \\u003c@U123\\u003e | Job `0123456789abcdef` | Took 1.234s")
+	assert.Contains(t, body, ":x: exit status 1 / Exit code: 1")
+	assert.Contains(t, body, "```\\n\\u0026lt;no such service\\u0026gt;\\n```")
+	assert.Contains(t, body, `"action_id":"slashes_rerun","value":"0123456789abcdef"`)
+	assert.Contains(t, body, `"url":"https://logs.example.com/jobs/0123456789abcdef"`)
+}
+
+// TestStartMessageBlocks tests rendering the start notice in the blocks format
+func TestStartMessageBlocks(t *testing.T) {
+	h := &Handler{MessageFormat: MessageFormatBlocks, Buttons: []Button{ButtonCancel}, Timeout: 5 * time.Second, logger: logrus.New()}
+	j := &job{id: "0123456789abcdef", cmd: slack.SlashCommand{Command: "/deploy", Text: "api", UserID: "U123"}}
+	msg := h.startMessage(j)
+
+	payload, err := json.Marshal(msg)
+	assert.NoError(t, err)
+	body := string(payload)
+	assert.Contains(t, body, "Job `0123456789abcdef` | Timeout 5s")
+	assert.Contains(t, body, ":hourglass_flowing_sand: Running")
+	assert.Contains(t, body, `"action_id":"slashes_cancel","value":"0123456789abcdef"`)
+	assert.Contains(t, body, `"style":"danger"`)
+}
+
+// TestCodeBlockTruncate tests keeping the tail of the long output within the limit
+func TestCodeBlockTruncate(t *testing.T) {
+	output := strings.Repeat("あ", 5000) + "end"
+	block := codeBlock(output, maxSectionLength)
+
+	assert.Len(t, []rune(block), maxSectionLength)
+	assert.True(t, strings.HasPrefix(block, "```\n..."))
+	assert.True(t, strings.HasSuffix(block, "end\n```"))
+}
+
+// TestParseMessageFormat tests parsing the message formats
+func TestParseMessageFormat(t *testing.T) {
+	format, err := ParseMessageFormat("")
+	assert.NoError(t, err)
+	assert.Equal(t, MessageFormatCode, format)
+
+	format, err = ParseMessageFormat("blocks")
+	assert.NoError(t, err)
+	assert.Equal(t, MessageFormatBlocks, format)
+
+	_, err = ParseMessageFormat("html")
+	assert.Error(t, err)
+
+	_, err = ParseButton("approve")
+	assert.Error(t, err)
+}
@@ -0,0 +1,101 @@
+package slack
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/slack-go/slack"
+)
+
+// OutputProtocol is how the output of the command is interpreted
+type OutputProtocol string
+
+const (
+	// OutputProtocolPlain posts the output as plain text, this is the default protocol
+	OutputProtocolPlain OutputProtocol = "plain"
+	// OutputProtocolJSON posts the output as a slack message payload if the whole output is a valid payload
+	OutputProtocolJSON OutputProtocol = "json"
+	// OutputProtocolMarker posts the output as a slack message payload if the first line is OutputMarker,
+	// the rest of the output is the payload
+	OutputProtocolMarker OutputProtocol = "marker"
+)
+
+// OutputMarker is the first line of the output of the marker protocol
+const OutputMarker = "#slashes:message"
+
+// ParseOutputProtocol parses the output protocol, empty string means the default protocol.
+func ParseOutputProtocol(s string) (OutputProtocol, error) {
+	switch protocol := OutputProtocol(s); protocol {
+	case "":
+		return OutputProtocolPlain, nil
+	case OutputProtocolPlain, OutputProtocolJSON, OutputProtocolMarker:
+		return protocol, nil
+	default:
+		return "", fmt.Errorf("unknown output protocol: %s", s)
+	}
+}
+
+// messagePayload is the slack message payload emitted by the command
+type messagePayload struct {
+	Text         string             `json:"text"`
+	Blocks       slack.Blocks       `json:"blocks"`
+	Attachments  []slack.Attachment `json:"attachments"`
+	ResponseType string             `json:"response_type"`
+}
+
+// parseMessagePayload returns the slack message of the output by the protocol.
+// It returns nil without error if the output is not meant to be a payload by the protocol.
+func parseMessagePayload(protocol OutputProtocol, output string) (*slack.Msg, error) {
+	var payload string
+	switch protocol {
+	case OutputProtocolJSON:
+		payload = strings.TrimSpace(output)
+		if !strings.HasPrefix(payload, "{") {
+			return nil, nil
+		}
+	case OutputProtocolMarker:
+		marker, rest, _ := strings.Cut(output, "\n")
+		if strings.TrimSpace(marker) != OutputMarker {
+			return nil, nil
+		}
+		payload = rest
+	default:
+		return nil, nil
+	}
+
+	// decode the payload, unknown fields are rejected to catch typos
+	var p messagePayload
+	decoder := json.NewDecoder(bytes.NewBufferString(payload))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&p); err != nil {
+		return nil, fmt.Errorf("malformed message payload: %w", err)
+	}
+	if decoder.More() {
+		return nil, errors.New("malformed message payload: trailing data after the payload")
+	}
+
+	// validate the payload
+	if p.Text == "" && len(p.Blocks.BlockSet) == 0 && len(p.Attachments) == 0 {
+		return nil, errors.New("invalid message payload: no text, blocks or attachments")
+	}
+	for _, block := range p.Blocks.BlockSet {
+		if _, ok := block.(*slack.UnknownBlock); ok {
+			return nil, fmt.Errorf("invalid message payload: unknown block type: %s", block.BlockType())
+		}
+	}
+	switch p.ResponseType {
+	case "", slack.ResponseTypeEphemeral, slack.ResponseTypeInChannel:
+	default:
+		return nil, fmt.Errorf("invalid message payload: unknown response type: %s", p.ResponseType)
+	}
+
+	return &slack.Msg{
+		Text:         p.Text,
+		Blocks:       p.Blocks,
+		Attachments:  p.Attachments,
+		ResponseType: p.ResponseType,
+	}, nil
+}
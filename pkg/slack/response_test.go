@@ -0,0 +1,51 @@
+package slack
+
+import (
+	"testing"
+
+	"github.com/slack-go/slack"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestParseMessagePayload tests parsing the output of the command as a slack message payload
+func TestParseMessagePayload(t *testing.T) {
+	cases := []struct {
+		protocol     OutputProtocol
+		output       string
+		text         string
+		blocks       int
+		responseType string
+		err          string
+	}{
+		{protocol: OutputProtocolPlain, output: `{"text": "hello"}`},
+		{protocol: OutputProtocolJSON, output: "hello"},
+		{protocol: OutputProtocolJSON, output: ` {"text": "hello", "response_type": "in_channel"}` + "\n", text: "hello", responseType: slack.ResponseTypeInChannel},
+		{protocol: OutputProtocolJSON, output: `{"blocks": [{"type": "section", "text": {"type": "mrkdwn", "text": "*hello*"}}]}`, blocks: 1},
+		{protocol: OutputProtocolJSON, output: `{"text": "hello"`, err: "malformed message payload: unexpected EOF"},
+		{protocol: OutputProtocolJSON, output: `{"txt": "hello"}`, err: `malformed message payload: json: unknown field "txt"`},
+		{protocol: OutputProtocolJSON, output: `{"text": "hello"} {}`, err: "malformed message payload: trailing data after the payload"},
+		{protocol: OutputProtocolJSON, output: `{}`, err: "invalid message payload: no text, blocks or attachments"},
+		{protocol: OutputProtocolJSON, output: `{"blocks": [{"type": "marquee"}]}`, err: "invalid message payload: unknown block type: marquee"},
+		{protocol: OutputProtocolJSON, output: `{"text": "hello", "response_type": "public"}`, err: "invalid message payload: unknown response type: public"},
+		{protocol: OutputProtocolMarker, output: `{"text": "hello"}`},
+		{protocol: OutputProtocolMarker, output: OutputMarker + "\n" + `{"text": "hello", "response_type": "ephemeral"}`, text: "hello", responseType: slack.ResponseTypeEphemeral},
+		{protocol: OutputProtocolMarker, output: OutputMarker + "\nhello", err: "malformed message payload: invalid character 'h' looking for beginning of value"},
+	}
+
+	for _, c := range cases {
+		msg, err := parseMessagePayload(c.protocol, c.output)
+		if c.err != "" {
+			assert.EqualError(t, err, c.err, c.output)
+			continue
+		}
+
+		assert.NoError(t, err, c.output)
+		if c.text == "" && c.blocks == 0 {
+			assert.Nil(t, msg, c.output)
+			continue
+		}
+		assert.Equal(t, c.text, msg.Text, c.output)
+		assert.Len(t, msg.Blocks.BlockSet, c.blocks, c.output)
+		assert.Equal(t, c.responseType, msg.ResponseType, c.output)
+	}
+}
@@ -0,0 +1,136 @@
+package slack
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/slack-go/slack"
+)
+
+// RetryPolicy is how the messages failed by the transient errors are retried
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of attempts including the first one, 1 or less means no retry
+	MaxAttempts int
+	// InitialBackoff is the wait before the first retry, doubled for each retry
+	InitialBackoff time.Duration
+	// MaxBackoff is the maximum wait between the retries
+	MaxBackoff time.Duration
+}
+
+// DefaultRetryPolicy is the default retry policy of the handler
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts:    4,
+	InitialBackoff: 500 * time.Millisecond,
+	MaxBackoff:     8 * time.Second,
+}
+
+// StatusError is the error of the response URL responded with the unexpected status
+type StatusError struct {
+	// StatusCode is the status code of the response
+	StatusCode int
+	// Body is the body of the response
+	Body string
+	// RetryAfter is the wait requested by the Retry-After header, 0 if not given
+	RetryAfter time.Duration
+}
+
+// Error implements error.
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("response URL responded with status %d: %s", e.StatusCode, e.Body)
+}
+
+// newStatusError returns the error of the response, the body is read by the caller
+func newStatusError(res *http.Response, body string) *StatusError {
+	err := &StatusError{StatusCode: res.StatusCode, Body: body}
+	if seconds, parseErr := strconv.Atoi(res.Header.Get("Retry-After")); parseErr == nil && seconds > 0 {
+		err.RetryAfter = time.Duration(seconds) * time.Second
+	}
+
+	return err
+}
+
+// retry calls the function until it succeeds, fails by a permanent error, or the attempts run out.
+// The wait is the exponential backoff with jitter, or the wait requested by the rate limit.
+func (h *Handler) retry(ctx context.Context, f func() error) error {
+	var err error
+	for attempt := 1; ; attempt++ {
+		if err = f(); err == nil {
+			return nil
+		}
+
+		// the failure by the context of the caller is never retried, while the timeout of the client is
+		transient, retryAfter := classifyError(err)
+		if !transient || attempt >= h.Retry.MaxAttempts || ctx.Err() != nil {
+			return err
+		}
+
+		wait := retryAfter
+		if wait == 0 {
+			wait = h.Retry.backoff(attempt)
+		}
+		h.logger.WithError(err).WithField("attempt", attempt).WithField("wait", wait).Warn("Failed to post the message, retrying")
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return fmt.Errorf("%w (gave up retrying: %s)", err, ctx.Err())
+		case <-timer.C:
+		}
+	}
+}
+
+// backoff returns the wait before the retry of the attempt, a random duration between the half and the whole of
+// the exponential backoff
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	backoff := p.InitialBackoff
+	for i := 1; i < attempt && backoff < p.MaxBackoff; i++ {
+		backoff *= 2
+	}
+	if p.MaxBackoff > 0 && backoff > p.MaxBackoff {
+		backoff = p.MaxBackoff
+	}
+	if backoff <= 0 {
+		return 0
+	}
+
+	half := backoff / 2
+	return half + time.Duration(rand.Int63n(int64(backoff-half)+1))
+}
+
+// classifyError returns whether the error is transient, and the wait requested by the rate limit
+func classifyError(err error) (bool, time.Duration) {
+	var statusErr *StatusError
+	var rateLimitedErr *slack.RateLimitedError
+	var slackStatusErr slack.StatusCodeError
+	var netErr net.Error
+
+	switch {
+	case errors.As(err, &statusErr):
+		return statusErr.StatusCode == http.StatusTooManyRequests || statusErr.StatusCode >= http.StatusInternalServerError, statusErr.RetryAfter
+	case errors.As(err, &rateLimitedErr):
+		return true, rateLimitedErr.RetryAfter
+	case errors.As(err, &slackStatusErr):
+		return slackStatusErr.Code >= http.StatusInternalServerError, 0
+	default:
+		// the http client wraps every failure in *url.Error, which is a net.Error even for the malformed URL and the
+		// certificate error, so the underlying error decides
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		if errors.As(err, &netErr) && netErr.Timeout() {
+			return true, 0
+		}
+		return errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.ECONNRESET) || errors.Is(err, io.ErrUnexpectedEOF), 0
+	}
+}
@@ -0,0 +1,130 @@
+package slack
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/slack-go/slack"
+	"github.com/stretchr/testify/assert"
+)
+
+// newRetryHandler returns a handler retrying without the backoff
+func newRetryHandler() *Handler {
+	logger := logrus.New()
+	logger.SetLevel(logrus.PanicLevel)
+	h := New(nil, http.DefaultClient, logger, "deploy", time.Second, "testToken")
+	h.Retry = RetryPolicy{MaxAttempts: 4, InitialBackoff: time.Millisecond, MaxBackoff: time.Millisecond}
+
+	return h
+}
+
+// TestPostMessageRetry tests retrying the transient failures of the response URL
+func TestPostMessageRetry(t *testing.T) {
+	var attempts int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch atomic.AddInt32(&attempts, 1) {
+		case 1:
+			w.WriteHeader(http.StatusInternalServerError)
+		case 2:
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusTooManyRequests)
+		default:
+			w.WriteHeader(http.StatusOK)
+		}
+	}))
+	defer server.Close()
+
+	startedAt := time.Now()
+	err := newRetryHandler().postMessage(context.Background(), server.URL, &slack.Msg{Text: "result"})
+	assert.NoError(t, err)
+	assert.Equal(t, int32(3), atomic.LoadInt32(&attempts))
+	// the wait requested by Retry-After is respected
+	assert.GreaterOrEqual(t, time.Since(startedAt), time.Second)
+}
+
+// TestPostMessageFail tests failing without retrying the permanent failures, and giving up the transient failures
+func TestPostMessageFail(t *testing.T) {
+	var attempts int32
+	status := http.StatusNotFound
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&attempts, 1)
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte("expired_url"))
+	}))
+	defer server.Close()
+
+	err := newRetryHandler().postMessage(context.Background(), server.URL, &slack.Msg{Text: "result"})
+	assert.EqualError(t, err, "response URL responded with status 404: expired_url")
+	assert.Equal(t, int32(1), atomic.LoadInt32(&attempts))
+
+	atomic.StoreInt32(&attempts, 0)
+	status = http.StatusBadGateway
+	err = newRetryHandler().postMessage(context.Background(), server.URL, &slack.Msg{Text: "result"})
+	assert.EqualError(t, err, "response URL responded with status 502: expired_url")
+	assert.Equal(t, int32(4), atomic.LoadInt32(&attempts))
+}
+
+// TestRetryPolicyBackoff tests the exponential backoff with jitter
+func TestRetryPolicyBackoff(t *testing.T) {
+	p := RetryPolicy{MaxAttempts: 10, InitialBackoff: 100 * time.Millisecond, MaxBackoff: time.Second}
+	for attempt, expected := range map[int]time.Duration{
+		1: 100 * time.Millisecond,
+		2: 200 * time.Millisecond,
+		3: 400 * time.Millisecond,
+		5: time.Second,
+		9: time.Second,
+	} {
+		for i := 0; i < 10; i++ {
+			backoff := p.backoff(attempt)
+			assert.GreaterOrEqual(t, backoff, expected/2, "attempt %d", attempt)
+			assert.LessOrEqual(t, backoff, expected, "attempt %d", attempt)
+		}
+	}
+}
+
+// TestClassifyError tests retrying only the transient errors of the http client
+func TestClassifyError(t *testing.T) {
+	// the connection refused by the closed server
+	closed := httptest.NewServer(http.NotFoundHandler())
+	closed.Close()
+	_, refusedErr := http.Post(closed.URL, "text/plain", nil)
+
+	// the timeout of the server not responding
+	blocking := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer blocking.Close()
+	_, timeoutErr := (&http.Client{Timeout: 10 * time.Millisecond}).Post(blocking.URL, "text/plain", nil)
+
+	// the certificate signed by the unknown authority
+	tlsServer := httptest.NewTLSServer(http.NotFoundHandler())
+	defer tlsServer.Close()
+	_, x509Err := http.Post(tlsServer.URL, "text/plain", nil)
+
+	_, malformedErr := http.Post("http://[::1", "text/plain", nil)
+
+	for _, c := range []struct {
+		name      string
+		err       error
+		transient bool
+	}{
+		{"refused", refusedErr, true},
+		{"timeout", timeoutErr, true},
+		{"unexpected eof", &url.Error{Op: "Post", URL: "http://example.com", Err: io.ErrUnexpectedEOF}, true},
+		{"status", &StatusError{StatusCode: http.StatusServiceUnavailable}, true},
+		{"x509", x509Err, false},
+		{"malformed", malformedErr, false},
+		{"canceled", context.Canceled, false},
+	} {
+		assert.Error(t, c.err, c.name)
+		transient, _ := classifyError(c.err)
+		assert.Equal(t, c.transient, transient, "%s: %v", c.name, c.err)
+	}
+}
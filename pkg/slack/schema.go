@@ -0,0 +1,349 @@
+package slack
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ParameterType is the type of the value of an argument or a flag
+type ParameterType string
+
+const (
+	// ParameterTypeString accepts any value, this is the default type
+	ParameterTypeString ParameterType = "string"
+	// ParameterTypeInt accepts a decimal integer
+	ParameterTypeInt ParameterType = "int"
+	// ParameterTypeEnum accepts one of the declared values
+	ParameterTypeEnum ParameterType = "enum"
+	// ParameterTypeDuration accepts a duration parsed by time.ParseDuration (e.g. 5m)
+	ParameterTypeDuration ParameterType = "duration"
+	// ParameterTypeDate accepts a date in the form of YYYY-MM-DD (e.g. 2024-01-31)
+	ParameterTypeDate ParameterType = "date"
+)
+
+// dateLayout is the layout of the date parameter
+const dateLayout = "2006-01-02"
+
+// Parameter is the declaration of a positional argument or a flag of the command
+type Parameter struct {
+	// Name is the name of the parameter, flags are given as --name=value or --name value
+	Name string `mapstructure:"name" json:"name"`
+	// Description is the description shown in the usage message
+	Description string `mapstructure:"description" json:"description,omitempty"`
+	// Type is the type of the value, empty means string
+	Type ParameterType `mapstructure:"type" json:"type,omitempty"`
+	// Required is whether the parameter must be given
+	Required bool `mapstructure:"required" json:"required,omitempty"`
+	// Default is the value used when the parameter is not given, empty means no default
+	Default string `mapstructure:"default" json:"default,omitempty"`
+	// Values is the accepted values of an enum parameter
+	Values []string `mapstructure:"values" json:"values,omitempty"`
+	// Pattern is the regular expression the whole value must match, empty means any value
+	Pattern string `mapstructure:"pattern" json:"pattern,omitempty"`
+	// Options is the source of the options of the select menu in the modal form, loaded on demand through the
+	// options URL. nil means the input of the type.
+	Options *OptionSource `mapstructure:"options" json:"options,omitempty"`
+}
+
+// OptionSource is the source of the options of a select menu, the options are listed one per line as value or
+// value<TAB>label
+type OptionSource struct {
+	// Command is the command printing the options, which runs on the local host within the options timeout
+	Command string `mapstructure:"command" json:"command,omitempty"`
+	// File is the file listing the options
+	File string `mapstructure:"file" json:"file,omitempty"`
+}
+
+// validate checks the value of the parameter.
+func (p *Parameter) validate(value string) error {
+	switch p.Type {
+	case ParameterTypeString, "":
+	case ParameterTypeInt:
+		if _, err := strconv.Atoi(value); err != nil {
+			return fmt.Errorf("%s must be an integer: %q", p.Name, value)
+		}
+	case ParameterTypeEnum:
+		if !contains(p.Values, value) {
+			return fmt.Errorf("%s must be one of %s: %q", p.Name, strings.Join(p.Values, ", "), value)
+		}
+	case ParameterTypeDuration:
+		if _, err := time.ParseDuration(value); err != nil {
+			return fmt.Errorf("%s must be a duration (e.g. 5m): %q", p.Name, value)
+		}
+	case ParameterTypeDate:
+		if _, err := time.Parse(dateLayout, value); err != nil {
+			return fmt.Errorf("%s must be a date (e.g. 2024-01-31): %q", p.Name, value)
+		}
+	default:
+		return fmt.Errorf("unknown type of %s: %s", p.Name, p.Type)
+	}
+
+	if p.Pattern != "" {
+		pattern, err := regexp.Compile("^(?:" + p.Pattern + ")$")
+		if err != nil {
+			return fmt.Errorf("invalid pattern of %s: %w", p.Name, err)
+		}
+		if !pattern.MatchString(value) {
+			return fmt.Errorf("%s must match %s: %q", p.Name, p.Pattern, value)
+		}
+	}
+
+	return nil
+}
+
+// placeholder returns the placeholder of the value shown in the usage message.
+func (p *Parameter) placeholder() string {
+	if p.Type == ParameterTypeEnum {
+		return strings.Join(p.Values, "|")
+	}
+
+	return p.Name
+}
+
+// Schema is the declaration of the arguments and the flags of the command
+type Schema struct {
+	// Description is the description of the command shown in the usage message
+	Description string `mapstructure:"description" json:"description,omitempty"`
+	// Args is the positional arguments in order, required arguments must precede optional ones
+	Args []Parameter `mapstructure:"args" json:"args,omitempty"`
+	// Flags is the flags, which can be given anywhere before --
+	Flags []Parameter `mapstructure:"flags" json:"flags,omitempty"`
+}
+
+// Arguments is the arguments validated by the schema, with the defaults filled in
+type Arguments struct {
+	// Args is the positional arguments
+	Args []string
+	// Flags is the flag values by name
+	Flags map[string]string
+}
+
+// Validate checks the schema itself, so a broken declaration is reported on startup.
+func (s *Schema) Validate() error {
+	names := make(map[string]bool)
+	optional := false
+	for i, params := range [][]Parameter{s.Args, s.Flags} {
+		for _, p := range params {
+			if p.Name == "" {
+				return fmt.Errorf("parameter without name")
+			}
+			if names[p.Name] {
+				return fmt.Errorf("duplicated parameter: %s", p.Name)
+			}
+			names[p.Name] = true
+
+			switch p.Type {
+			case ParameterTypeString, ParameterTypeInt, ParameterTypeDuration, ParameterTypeDate, "":
+			case ParameterTypeEnum:
+				if len(p.Values) == 0 {
+					return fmt.Errorf("enum %s without values", p.Name)
+				}
+			default:
+				return fmt.Errorf("unknown type of %s: %s", p.Name, p.Type)
+			}
+			if _, err := regexp.Compile(p.Pattern); err != nil {
+				return fmt.Errorf("invalid pattern of %s: %w", p.Name, err)
+			}
+			if p.Options != nil {
+				if (p.Options.Command == "") == (p.Options.File == "") {
+					return fmt.Errorf("options of %s must have either command or file", p.Name)
+				}
+				if p.Type != ParameterTypeString && p.Type != "" {
+					return fmt.Errorf("options of %s are only for the string type: %s", p.Name, p.Type)
+				}
+			}
+			if p.Default != "" {
+				if err := p.validate(p.Default); err != nil {
+					return fmt.Errorf("invalid default: %w", err)
+				}
+			}
+
+			// only the positional arguments are ordered
+			if i == 0 {
+				if p.Required && optional {
+					return fmt.Errorf("required argument %s follows an optional argument", p.Name)
+				}
+				optional = optional || !p.Required
+			}
+		}
+	}
+
+	return nil
+}
+
+// Parse validates the parsed command line against the schema.
+func (s *Schema) Parse(args []string) (*Arguments, error) {
+	result := &Arguments{Args: []string{}, Flags: make(map[string]string)}
+
+	// split the flags from the positional arguments
+	positional := []string{}
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			positional = append(positional, args[i+1:]...)
+			break
+		}
+		if !strings.HasPrefix(arg, "--") {
+			positional = append(positional, arg)
+			continue
+		}
+
+		name, value, hasValue := strings.Cut(strings.TrimPrefix(arg, "--"), "=")
+		flag := s.flag(name)
+		if flag == nil {
+			return nil, fmt.Errorf("unknown flag: --%s", name)
+		}
+		if !hasValue {
+			if i+1 >= len(args) {
+				return nil, fmt.Errorf("flag needs a value: --%s", name)
+			}
+			i++
+			value = args[i]
+		}
+		if err := flag.validate(value); err != nil {
+			return nil, err
+		}
+		result.Flags[name] = value
+	}
+
+	// positional arguments
+	if len(positional) > len(s.Args) {
+		return nil, fmt.Errorf("too many arguments: %s", strings.Join(positional[len(s.Args):], " "))
+	}
+	for i, p := range s.Args {
+		if i < len(positional) {
+			if err := p.validate(positional[i]); err != nil {
+				return nil, err
+			}
+			result.Args = append(result.Args, positional[i])
+			continue
+		}
+
+		if p.Required {
+			return nil, fmt.Errorf("missing argument: %s", p.Name)
+		}
+		if p.Default == "" {
+			break
+		}
+		result.Args = append(result.Args, p.Default)
+	}
+
+	// flags
+	for _, p := range s.Flags {
+		if _, ok := result.Flags[p.Name]; ok {
+			continue
+		}
+
+		if p.Required {
+			return nil, fmt.Errorf("missing flag: --%s", p.Name)
+		}
+		if p.Default != "" {
+			result.Flags[p.Name] = p.Default
+		}
+	}
+
+	return result, nil
+}
+
+// flag returns the flag declaration by name, nil if not declared.
+func (s *Schema) flag(name string) *Parameter {
+	for i := range s.Flags {
+		if s.Flags[i].Name == name {
+			return &s.Flags[i]
+		}
+	}
+
+	return nil
+}
+
+// Usage returns the usage message of the command generated from the schema.
+func (s *Schema) Usage(command string) string {
+	var b strings.Builder
+
+	// synopsis
+	b.WriteString("Usage: " + command)
+	if len(s.Flags) > 0 {
+		b.WriteString(" [flags]")
+	}
+	for _, p := range s.Args {
+		if p.Required {
+			fmt.Fprintf(&b, " <%s>", p.placeholder())
+		} else {
+			fmt.Fprintf(&b, " [%s]", p.placeholder())
+		}
+	}
+	b.WriteString("\n")
+
+	if s.Description != "" {
+		b.WriteString("\n" + s.Description + "\n")
+	}
+
+	if len(s.Args) > 0 {
+		b.WriteString("\nArguments:\n")
+		for _, p := range s.Args {
+			writeParameter(&b, p.Name, p)
+		}
+	}
+
+	if len(s.Flags) > 0 {
+		b.WriteString("\nFlags:\n")
+		for _, p := range s.Flags {
+			writeParameter(&b, fmt.Sprintf("--%s=<%s>", p.Name, p.placeholder()), p)
+		}
+	}
+
+	return b.String()
+}
+
+// writeParameter writes a line of the parameter to the usage message.
+func writeParameter(b *strings.Builder, name string, p Parameter) {
+	fmt.Fprintf(b, "  %s", name)
+	if p.Description != "" {
+		fmt.Fprintf(b, "  %s", p.Description)
+	}
+	if p.Type == ParameterTypeInt || p.Type == ParameterTypeDuration || p.Type == ParameterTypeDate {
+		fmt.Fprintf(b, " (%s)", p.Type)
+	}
+	if p.Required {
+		b.WriteString(" (required)")
+	}
+	if p.Default != "" {
+		fmt.Fprintf(b, " (default: %s)", p.Default)
+	}
+	b.WriteString("\n")
+}
+
+// Argv returns the command line passed to the command, the flags as --name=value
+// in the declared order followed by the positional arguments. The positional arguments
+// are preceded by -- if any of them looks like a flag.
+func (a *Arguments) Argv(schema *Schema) []string {
+	argv := []string{}
+	for _, p := range schema.Flags {
+		if value, ok := a.Flags[p.Name]; ok {
+			argv = append(argv, fmt.Sprintf("--%s=%s", p.Name, value))
+		}
+	}
+
+	for _, arg := range a.Args {
+		if strings.HasPrefix(arg, "-") {
+			argv = append(argv, "--")
+			break
+		}
+	}
+
+	return append(argv, a.Args...)
+}
+
+// contains returns whether the values contain the value.
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
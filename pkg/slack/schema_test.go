@@ -0,0 +1,98 @@
+package slack
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// deploySchema is the schema of a deploy command used in the tests
+var deploySchema = &Schema{
+	Description: "Deploy a service",
+	Args: []Parameter{
+		{Name: "service", Type: ParameterTypeEnum, Values: []string{"api", "web"}, Required: true, Description: "service to deploy"},
+		{Name: "env", Default: "staging", Pattern: `[a-z]+`},
+		{Name: "replicas", Type: ParameterTypeInt},
+	},
+	Flags: []Parameter{
+		{Name: "tag", Pattern: `v\d+`, Required: true},
+		{Name: "wait", Type: ParameterTypeDuration, Default: "5m"},
+	},
+}
+
+// TestSchemaParse tests validating the command lines against the schema
+func TestSchemaParse(t *testing.T) {
+	cases := []struct {
+		args []string
+		argv []string
+		err  string
+	}{
+		{args: []string{"api", "--tag=v1"}, argv: []string{"--tag=v1", "--wait=5m", "api", "staging"}},
+		{args: []string{"--wait", "1m", "web", "prod", "3", "--tag", "v2"}, argv: []string{"--tag=v2", "--wait=1m", "web", "prod", "3"}},
+		{args: []string{"--tag=v1", "--", "api", "prod", "-1"}, argv: []string{"--tag=v1", "--wait=5m", "--", "api", "prod", "-1"}},
+		{args: []string{"--tag=v1", "--", "api", "prod", "1", "--wait"}, err: "too many arguments: --wait"},
+		{args: []string{"--tag=v1"}, err: "missing argument: service"},
+		{args: []string{"api"}, err: "missing flag: --tag"},
+		{args: []string{"db", "--tag=v1"}, err: `service must be one of api, web: "db"`},
+		{args: []string{"api", "Prod", "--tag=v1"}, err: `env must match [a-z]+: "Prod"`},
+		{args: []string{"api", "prod", "three", "--tag=v1"}, err: `replicas must be an integer: "three"`},
+		{args: []string{"api", "--tag=v1", "--wait=soon"}, err: `wait must be a duration (e.g. 5m): "soon"`},
+		{args: []string{"api", "--tag=v1x"}, err: `tag must match v\d+: "v1x"`},
+		{args: []string{"api", "--tag"}, err: "flag needs a value: --tag"},
+		{args: []string{"api", "--tag=v1", "--force"}, err: "unknown flag: --force"},
+	}
+
+	for _, c := range cases {
+		parsed, err := deploySchema.Parse(c.args)
+		if c.err != "" {
+			assert.EqualError(t, err, c.err, c.args)
+			continue
+		}
+
+		assert.NoError(t, err, c.args)
+		assert.Equal(t, c.argv, parsed.Argv(deploySchema), c.args)
+	}
+}
+
+// TestSchemaValidate tests checking the schema declarations
+func TestSchemaValidate(t *testing.T) {
+	assert.NoError(t, deploySchema.Validate())
+
+	cases := []struct {
+		schema Schema
+		err    string
+	}{
+		{schema: Schema{Args: []Parameter{{}}}, err: "parameter without name"},
+		{schema: Schema{Args: []Parameter{{Name: "env"}}, Flags: []Parameter{{Name: "env"}}}, err: "duplicated parameter: env"},
+		{schema: Schema{Args: []Parameter{{Name: "env", Type: ParameterTypeEnum}}}, err: "enum env without values"},
+		{schema: Schema{Args: []Parameter{{Name: "count", Type: "float"}}}, err: "unknown type of count: float"},
+		{schema: Schema{Args: []Parameter{{Name: "service", Options: &OptionSource{}}}}, err: "options of service must have either command or file"},
+		{schema: Schema{Args: []Parameter{{Name: "service", Options: &OptionSource{Command: "ls", File: "services"}}}}, err: "options of service must have either command or file"},
+		{schema: Schema{Args: []Parameter{{Name: "count", Type: ParameterTypeInt, Options: &OptionSource{File: "counts"}}}}, err: "options of count are only for the string type: int"},
+		{schema: Schema{Flags: []Parameter{{Name: "count", Type: ParameterTypeInt, Default: "many"}}}, err: `invalid default: count must be an integer: "many"`},
+		{schema: Schema{Args: []Parameter{{Name: "env", Pattern: "("}}}, err: "invalid pattern of env: error parsing regexp: missing closing ): `(`"},
+		{schema: Schema{Args: []Parameter{{Name: "env"}, {Name: "service", Required: true}}}, err: "required argument service follows an optional argument"},
+	}
+
+	for _, c := range cases {
+		assert.EqualError(t, c.schema.Validate(), c.err)
+	}
+}
+
+// TestSchemaUsage tests generating the usage message from the schema
+func TestSchemaUsage(t *testing.T) {
+	expected := `Usage: /deploy [flags] <api|web> [env] [replicas]
+
+Deploy a service
+
+Arguments:
+  service  service to deploy (required)
+  env (default: staging)
+  replicas (int)
+
+Flags:
+  --tag=<tag> (required)
+  --wait=<wait> (duration) (default: 5m)
+`
+	assert.Equal(t, expected, deploySchema.Usage("/deploy"))
+}
@@ -4,15 +4,17 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"strings"
+	"text/template"
 	"time"
 
 	"github.com/HatsuneMiku3939/slashes/pkg/invoker"
 
 	"github.com/labstack/echo/v4"
-	shellwords "github.com/mattn/go-shellwords"
 	"github.com/sirupsen/logrus"
 	"github.com/slack-go/slack"
 )
@@ -30,7 +32,73 @@ type Handler struct {
 	Timeout time.Duration
 	// VerificationToken is the token used to verify the request
 	VerificationToken string
+	// SigningSecret is the signing secret verifying the requests of the interactions and the options, the
+	// verification token is used instead when empty
+	SigningSecret string
+	// TextFormat is how the slack formatting in the command text is decoded before parsing the arguments
+	TextFormat TextFormat
+	// ArgumentMode is the way the command text is passed to the command
+	ArgumentMode ArgumentMode
+	// Schema is the declaration of the arguments, nil means any arguments are passed as is
+	Schema *Schema
+	// ArgvTemplate is the template building the command line from the arguments, nil means the arguments are passed as is
+	ArgvTemplate ArgvTemplate
+	// MessageFormat is the format of the messages posted to slack
+	MessageFormat MessageFormat
+	// Buttons is the buttons attached to the messages in the blocks format
+	Buttons []Button
+	// LogURL is the template of the URL of the full log opened by the log button, nil means no log button
+	LogURL *template.Template
+	// OutputProtocol is how the output of the successful command is interpreted
+	OutputProtocol OutputProtocol
+	// StartResponseType is the response type of the start notice, ephemeral or in_channel
+	StartResponseType string
+	// FinishResponseType is the response type of the result, ephemeral or in_channel
+	FinishResponseType string
+	// PublicFlag is the flag users add at the beginning or the end of the text to post the result in the channel
+	// (e.g. --public), empty means disabled
+	PublicFlag string
+	// ReplaceOriginal is whether the result replaces the start notice
+	ReplaceOriginal bool
+	// DeleteOriginal is whether the start notice is deleted before the result is posted
+	DeleteOriginal bool
+	// Templates is the templates of the messages
+	Templates MessageTemplates
+	// SuppressStart is whether the start notice is not posted, for the fast commands
+	SuppressStart bool
+	// SyncBudget is how long the handler waits for the command to respond with the result directly,
+	// the result is posted to the response URL if the command runs longer. 0 means always asynchronous.
+	// It must be shorter than 3 seconds, which slack waits for the response.
+	SyncBudget time.Duration
+	// Retry is how the messages failed by the transient errors are retried
+	Retry RetryPolicy
+	// DeadLetters is the store of the results which could not be delivered, nil means they are only logged
+	DeadLetters DeadLetterStore
+	// BotToken is the bot token of the slack Web API. If set, the messages in the channel are posted by
+	// chat.postMessage and updated in place with the progress and the result by chat.update, while the ephemeral
+	// messages are still sent to the response URL. Empty means the messages are posted to the response URL.
+	BotToken string
+	// APIURL is the base URL of the slack Web API, empty means the default
+	APIURL string
+	// ProgressInterval is how often the message posted by the Web API is updated with the elapsed time,
+	// 0 means no progress is reported
+	ProgressInterval time.Duration
+	// ThreadResult is whether the result is posted as a reply in the thread of the message posted by the Web API
+	ThreadResult bool
+	// AuditChannels is the channels the results are mirrored to by the Web API, in addition to the requester
+	AuditChannels []string
 
+	// ModalForm is whether the modal form generated from the schema is opened for the slash command without the text,
+	// which requires the bot token
+	ModalForm bool
+	// ApprovalRequired is whether the jobs wait for the approval by the approve button before running
+	ApprovalRequired bool
+	// Approvers is the IDs of the users who can approve the jobs, empty means anyone but the requester. They can also
+	// cancel and rerun the jobs of the others.
+	Approvers []string
+
+	// jobs is the recent jobs for the interactions
+	jobs jobRegistry
 	// logger is the logger used to log the events
 	logger *logrus.Logger
 }
@@ -38,19 +106,25 @@ type Handler struct {
 // New returns a new Handler
 func New(invoker invoker.Invoker, httpClient *http.Client, logger *logrus.Logger, command string, timeout time.Duration, verificationToken string) *Handler {
 	return &Handler{
-		Invoker:           invoker,
-		HTTPClient:        httpClient,
-		Command:           command,
-		Timeout:           timeout,
-		VerificationToken: verificationToken,
+		Invoker:            invoker,
+		HTTPClient:         httpClient,
+		Command:            command,
+		Timeout:            timeout,
+		VerificationToken:  verificationToken,
+		ArgumentMode:       ArgumentModeShellwords,
+		MessageFormat:      MessageFormatCode,
+		OutputProtocol:     OutputProtocolPlain,
+		StartResponseType:  slack.ResponseTypeEphemeral,
+		FinishResponseType: slack.ResponseTypeEphemeral,
+		Retry:              DefaultRetryPolicy,
 
 		logger: logger,
 	}
 }
 
 const (
-	// notifyTimeout is the timeout for the notification
-	notifyTimeout = 10 * time.Second
+	// notifyTimeout is the timeout for the notification including the retries
+	notifyTimeout = 30 * time.Second
 )
 
 // Handle is the function that handles the slack slash command
@@ -69,9 +143,46 @@ func (h *Handler) Handler() func(c echo.Context) error {
 			return echo.NewHTTPError(http.StatusUnauthorized)
 		}
 
+		// ask the arguments by the modal form, the job of the submission is started by the interaction handler
+		if h.useModal(cmd) {
+			ctx, cancel := context.WithTimeout(c.Request().Context(), notifyTimeout)
+			defer cancel()
+			err := h.openModal(ctx, cmd)
+			if err == nil {
+				return c.NoContent(http.StatusOK)
+			}
+			h.logger.WithError(err).Warn("Failed to open the modal form, fall back to the command line")
+		}
+
+		// parse the arguments, the invalid input is rejected with the usage message without invoking the command
+		j := h.newJob(cmd)
+		if h.Schema != nil {
+			if isHelp(j.args) {
+				return c.JSON(http.StatusOK, usageMessage(h.Schema.Usage(cmd.Command)))
+			}
+			if j.err != nil {
+				h.logger.WithField("command", cmd.Text).WithError(j.err).Info("Invalid arguments")
+				return c.JSON(http.StatusOK, usageMessage(fmt.Sprintf("%s\n\n%s", j.err, h.Schema.Usage(cmd.Command))))
+			}
+		}
+
+		// keep the job for the interactions
+		h.jobs.add(j)
+
+		// hold the job until approved
+		if h.ApprovalRequired {
+			go h.requestApproval(j)
+			return c.NoContent(http.StatusOK)
+		}
+
+		// respond with the result if the command finishes within the budget
+		if h.SyncBudget > 0 {
+			return h.respondCommand(c, j)
+		}
+
 		// handle the command in background after the confirmation message is sent
 		defer func() {
-			go h.handleCommand(cmd)
+			go h.handleCommand(j)
 		}()
 
 		// sent back a confirmation response
@@ -79,97 +190,291 @@ func (h *Handler) Handler() func(c echo.Context) error {
 	}
 }
 
+// newJob parses the decoded text of the slash command by the argument mode and the schema,
+// and builds the command line by the template
+func (h *Handler) newJob(cmd slack.SlashCommand) *job {
+	j := &job{id: newJobID(), cmd: cmd, command: h.Command, startedAt: time.Now()}
+	j.ctx, j.cancel = context.WithCancel(context.Background())
+
+	// decode the slack formatting, the original text is kept in the job
+	decoded := cmd
+	decoded.Text = h.TextFormat.Decode(cmd.Text)
+
+	// the public flag is for the handler, not for the command
+	decoded.Text, j.public = cutFlag(decoded.Text, h.PublicFlag)
+
+	args, stdin, err := parseArgs(h.ArgumentMode, decoded)
+	if err != nil {
+		j.err = err
+		return j
+	}
+	j.stdin = stdin
+	h.buildArgs(j, args)
+
+	return j
+}
+
+// buildArgs validates the arguments against the schema, and builds the command line by the template
+func (h *Handler) buildArgs(j *job, args []string) {
+	j.args = args
+
+	// validate the arguments against the schema, help is answered with the usage message
+	var err error
+	arguments := &Arguments{Args: args, Flags: map[string]string{}}
+	if h.Schema != nil {
+		if isHelp(args) {
+			return
+		}
+		if arguments, err = h.Schema.Parse(args); err != nil {
+			j.err = err
+			return
+		}
+		j.args = arguments.Argv(h.Schema)
+	}
+
+	// build the command line by the template
+	if h.ArgvTemplate != nil {
+		if j.args, err = h.ArgvTemplate.Execute(arguments, newSlackContext(j.cmd)); err != nil {
+			j.err = fmt.Errorf("failed to build the command line: %w", err)
+		}
+	}
+}
+
+// cutFlag removes the flag at the beginning or the end of the text, and returns whether the flag was found
+func cutFlag(text string, flag string) (string, bool) {
+	if flag == "" {
+		return text, false
+	}
+
+	trimmed := strings.TrimSpace(text)
+	switch {
+	case trimmed == flag:
+		return "", true
+	case strings.HasPrefix(trimmed, flag+" "):
+		return strings.TrimLeft(trimmed[len(flag):], " "), true
+	case strings.HasSuffix(trimmed, " "+flag):
+		return strings.TrimRight(trimmed[:len(trimmed)-len(flag)], " "), true
+	default:
+		return text, false
+	}
+}
+
+// newSlackContext returns the slack context of the slash command passed to the invoker
+func newSlackContext(cmd slack.SlashCommand) invoker.SlackContext {
+	return invoker.SlackContext{
+		TeamID:      cmd.TeamID,
+		TeamDomain:  cmd.TeamDomain,
+		ChannelID:   cmd.ChannelID,
+		ChannelName: cmd.ChannelName,
+		UserID:      cmd.UserID,
+		UserName:    cmd.UserName,
+		Command:     cmd.Command,
+		Text:        cmd.Text,
+	}
+}
+
+// isHelp returns whether the arguments ask for the usage message
+func isHelp(args []string) bool {
+	return len(args) == 1 && (args[0] == "help" || args[0] == "--help")
+}
+
+// usageMessage returns the ephemeral message of the usage sent in the response,
+// the placeholders such as <name> are escaped not to be taken as slack links
+func usageMessage(usage string) *slack.Msg {
+	msg := codeMessage(escapeText(strings.TrimSpace(usage)))
+	msg.ResponseType = slack.ResponseTypeEphemeral
+
+	return msg
+}
+
+// start is the function that runs the job in background, or holds it until approved
+func (h *Handler) start(j *job) {
+	if h.ApprovalRequired {
+		h.requestApproval(j)
+		return
+	}
+	h.handleCommand(j)
+}
+
 // handleCommand is the function that handles the command in background
-func (h *Handler) handleCommand(cmd slack.SlashCommand) {
+func (h *Handler) handleCommand(j *job) {
 	// notify the user that the command is being handled
-	if err := h.notifyStart(cmd); err != nil {
-		h.logger.WithError(err).Error("Failed to notify command is being handled")
-		return
+	if !h.SuppressStart {
+		if err := h.notifyStart(j); err != nil {
+			h.logger.WithError(err).Error("Failed to notify command is being handled")
+			return
+		}
 	}
 
-	// invoke the command
-	exitCode, invokeOut, invokeErr := h.invoke(context.Background(), cmd)
+	// invoke the command, the progress is reported until the command is finished
+	results := make(chan *result, 1)
+	go func() {
+		results <- h.invoke(j.ctx, j)
+	}()
+	r := h.awaitResult(j, results)
+
+	// notify the user that the command is finished
+	if err := h.notifyFinish(j, r); err != nil {
+		h.deadLetter(j, r, err)
+	}
+}
+
+// respondCommand is the function that responds with the result of the command finished within the budget,
+// or falls back to the asynchronous notifications
+func (h *Handler) respondCommand(c echo.Context, j *job) error {
+	results := make(chan *result, 1)
+	go func() {
+		results <- h.invoke(j.ctx, j)
+	}()
+
+	timer := time.NewTimer(h.SyncBudget)
+	defer timer.Stop()
+
+	select {
+	case r := <-results:
+		h.logResult(r)
+		go h.mirrorResult(j, r)
+		return c.JSON(http.StatusOK, h.finishMessage(j, r))
+	case <-timer.C:
+		// sent back a confirmation response, and wait the command in background
+		go h.awaitCommand(j, results)
+		return c.NoContent(http.StatusOK)
+	}
+}
+
+// awaitCommand is the function that notifies the result of the command running longer than the budget
+func (h *Handler) awaitCommand(j *job, results <-chan *result) {
+	// notify the user that the command is being handled, the command is already running
+	if !h.SuppressStart {
+		if err := h.notifyStart(j); err != nil {
+			h.logger.WithError(err).Error("Failed to notify command is being handled")
+		}
+	}
 
 	// notify the user that the command is finished
-	if err := h.notifyFinish(cmd, exitCode, invokeOut, invokeErr); err != nil {
-		h.logger.WithError(err).Error("Failed to notify command is finished")
+	r := h.awaitResult(j, results)
+	if err := h.notifyFinish(j, r); err != nil {
+		h.deadLetter(j, r, err)
 	}
 }
 
 // notifyStart is the function that notifies the user that the command is being handled
-func (h *Handler) notifyStart(cmd slack.SlashCommand) error {
+func (h *Handler) notifyStart(j *job) error {
 	ctx, cancel := context.WithTimeout(context.Background(), notifyTimeout)
 	defer cancel()
 
-	return h.postMessage(ctx, cmd, fmt.Sprintf("Invoke Command with %s timeout...\n$ %s %s", h.Timeout, h.Command, cmd.Text))
+	return h.notify(ctx, j, h.startMessage(j), false)
 }
 
 // notifyFinish is the function that notifies the user that the command is finished
-func (h *Handler) notifyFinish(cmd slack.SlashCommand, exitCode int, invokeOut string, invokeErr error) error {
+func (h *Handler) notifyFinish(j *job, r *result) error {
 	ctx, cancel := context.WithTimeout(context.Background(), notifyTimeout)
 	defer cancel()
 
-	// notify the user that the command is finished
-	exitStatus := fmt.Sprintf("Exit code: %d", exitCode)
-	if invokeErr != nil {
-		var errMessage string
-		switch {
-		case ctx.Err() == context.Canceled:
-			errMessage = "Command canceled"
-		case ctx.Err() == context.DeadlineExceeded:
-			errMessage = "Command timed out"
-		default:
-			errMessage = invokeErr.Error()
+	// the message posted by the Web API is updated in place instead
+	if h.DeleteOriginal && j.ts == "" {
+		if err := h.respond(ctx, j, &slack.Msg{DeleteOriginal: true}, false); err != nil {
+			h.logger.WithError(err).Warn("Failed to delete the start notice")
 		}
-
-		h.logger.WithError(invokeErr).WithField("exitCode", exitCode).Error("Failed to invoke the command")
-		message := fmt.Sprintf("%s\n\n%s\n%s", invokeOut, errMessage, exitStatus)
-		return h.postMessage(ctx, cmd, message)
 	}
 
-	// send the output
-	var message string
-	if exitCode != 0 {
-		h.logger.WithField("exitCode", exitCode).Info("Command exited with non-zero exit code")
-		message = fmt.Sprintf("%s\n\n%s", invokeOut, exitStatus)
-	} else {
-		message = invokeOut
+	h.logResult(r)
+	err := h.deliverResult(ctx, j, r)
+	h.mirrorResult(j, r)
+
+	return err
+}
+
+// deliverResult posts the result of the command to the requester or the channel
+func (h *Handler) deliverResult(ctx context.Context, j *job, r *result) error {
+	msg := h.finishMessage(j, r)
+	if !h.postsWebAPI(j, msg, true) {
+		// the result is sent to the requester privately, the message in the channel only shows the outcome
+		if j.ts != "" {
+			h.markFinished(ctx, j, r, "")
+		}
+		return h.notify(ctx, j, msg, true)
 	}
+	if h.ThreadResult && j.ts != "" && j.threadTS == "" {
+		err := h.replyInThread(ctx, j, r)
+		if err == nil {
+			return nil
+		}
+		h.logger.WithError(err).WithField("job", j.id).Warn("Failed to reply in the thread, fall back to update the message")
+	}
+
+	return h.notify(ctx, j, msg, true)
+}
 
-	return h.postMessage(ctx, cmd, message)
+// logResult logs the result of the command
+func (h *Handler) logResult(r *result) {
+	switch r.outcome() {
+	case OutcomeSuccess:
+	case OutcomeFailure:
+		h.logger.WithField("exitCode", r.exitCode).Info("Command exited with non-zero exit code")
+	default:
+		h.logger.WithError(r.err).WithField("exitCode", r.exitCode).Error("Failed to invoke the command")
+	}
 }
 
 // invoke is the function that invoke the command
-func (h *Handler) invoke(ctx context.Context, cmd slack.SlashCommand) (int, string, error) {
+func (h *Handler) invoke(ctx context.Context, j *job) *result {
 	// create a context with a timeout
 	ctx, cancel := context.WithTimeout(ctx, h.Timeout)
 	defer cancel()
 
-	// Parse the command as a command line
-	args, err := shellwords.Parse(cmd.Text)
-	if err != nil {
-		h.logger.WithField("command", cmd.Text).WithError(err).Error("malformed argument")
-		return -1, "", fmt.Errorf("malformed argument: %s %w", cmd.Text, err)
+	// the arguments are parsed before the confirmation
+	if j.err != nil {
+		h.logger.WithField("command", j.cmd.Text).WithError(j.err).Error("malformed argument")
+		return &result{exitCode: -1, err: j.err}
+	}
+	if j.stdin != nil {
+		ctx = invoker.WithStdin(ctx, *j.stdin)
+	}
+
+	// the job may be canceled before running
+	if err := ctx.Err(); err != nil {
+		return &result{exitCode: -1, err: err}
 	}
 
+	// pass the slack context to the invoker
+	ctx = invoker.WithSlackContext(ctx, newSlackContext(j.cmd))
+
 	// invoke the command
-	h.logger.WithField("command", h.Command).WithField("args", args).Info("Invoking command")
-	return h.Invoker.Invoke(ctx, h.Command, args...)
+	h.logger.WithField("command", j.command).WithField("args", j.args).WithField("job", j.id).Info("Invoking command")
+	startedAt := time.Now()
+	exitCode, output, err := h.Invoker.Invoke(ctx, j.command, j.args...)
+
+	// the command killed by the cancel action is reported as canceled
+	if err != nil && errors.Is(ctx.Err(), context.Canceled) && !errors.Is(err, context.Canceled) {
+		err = fmt.Errorf("%w: %v", context.Canceled, err)
+	}
+
+	return &result{
+		exitCode: exitCode,
+		output:   output,
+		err:      err,
+		timedOut: err != nil && ctx.Err() == context.DeadlineExceeded,
+		duration: time.Since(startedAt),
+	}
 }
 
-// postMessage is the function that sends a message to the user who sent the command
-func (h *Handler) postMessage(ctx context.Context, cmd slack.SlashCommand, text string) error {
+// postMessage is the function that sends a message to the response URL of the command, retrying the transient failures
+func (h *Handler) postMessage(ctx context.Context, responseURL string, msg *slack.Msg) error {
 	// marshal the message
-	message, err := json.Marshal(&slack.Msg{
-		Text:         fmt.Sprintf("```\n%s\n```", text),
-		ResponseType: slack.ResponseTypeEphemeral,
-	})
+	message, err := json.Marshal(msg)
 	if err != nil {
 		return err
 	}
 
-	// send the message
-	req, err := http.NewRequestWithContext(ctx, "POST", cmd.ResponseURL, bytes.NewBuffer(message))
+	return h.retry(ctx, func() error {
+		return h.sendMessage(ctx, responseURL, message)
+	})
+}
+
+// sendMessage is the function that sends a marshaled message to the response URL once
+func (h *Handler) sendMessage(ctx context.Context, responseURL string, message []byte) error {
+	req, err := http.NewRequestWithContext(ctx, "POST", responseURL, bytes.NewBuffer(message))
 	if err != nil {
 		return err
 	}
@@ -181,11 +486,19 @@ func (h *Handler) postMessage(ctx context.Context, cmd slack.SlashCommand, text
 	}
 	defer res.Body.Close()
 
-	// drain the body
+	// read the body for the error, and drain the rest
+	body, err := io.ReadAll(io.LimitReader(res.Body, 1024))
+	if err != nil {
+		h.logger.WithError(err).Warn("Failed to read the response body")
+	}
 	if _, err = io.Copy(io.Discard, res.Body); err != nil {
 		// ignore the error
 		h.logger.WithError(err).Warn("Failed to drain the response body")
 	}
 
+	if res.StatusCode < http.StatusOK || res.StatusCode >= http.StatusMultipleChoices {
+		return newStatusError(res, strings.TrimSpace(string(body)))
+	}
+
 	return nil
 }
@@ -2,6 +2,8 @@ package slack
 
 import (
 	"bytes"
+	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"net/http"
@@ -11,10 +13,12 @@ import (
 	"testing"
 	"time"
 
+	"github.com/HatsuneMiku3939/slashes/pkg/invoker"
 	"github.com/HatsuneMiku3939/slashes/pkg/invoker/mocks"
 
 	"github.com/labstack/echo/v4"
 	"github.com/sirupsen/logrus"
+	"github.com/slack-go/slack"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/suite"
@@ -87,6 +91,392 @@ func (suite *HandlerTestSuite) TestHandlerSuccess() {
 	assert.Contains(suite.T(), suite.monitor.body[1], "hatsune miku")
 }
 
+func (suite *HandlerTestSuite) TestHandlerSlackContext() {
+	// mock invoker
+	hasSlackContext := mock.MatchedBy(func(ctx context.Context) bool {
+		slackContext, ok := invoker.SlackContextFrom(ctx)
+		return ok && slackContext.UserID == "U123" && slackContext.UserName == "miku" && slackContext.Text == "hatsune miku"
+	})
+	suite.invoker.On("Invoke", hasSlackContext, "/usr/bin/echo", "hatsune", "miku").Return(0, "hatsune miku", nil)
+
+	// create request
+	form := make(url.Values)
+	form.Add("token", "testToken")
+	form.Add("text", "hatsune miku")
+	form.Add("user_id", "U123")
+	form.Add("user_name", "miku")
+	form.Add("response_url", "https://dummy")
+
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", echo.MIMEApplicationForm)
+
+	e := echo.New()
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+
+	// invoke handler
+	err := suite.handler.Handler()(c)
+	// wait for the command to finish
+	time.Sleep(100 * time.Millisecond)
+
+	// assert
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), http.StatusOK, rec.Code)
+	suite.invoker.AssertExpectations(suite.T())
+}
+
+func (suite *HandlerTestSuite) TestHandlerFuncInvoker() {
+	// register a go function as the command
+	funcInvoker := invoker.NewFuncInvoker()
+	funcInvoker.Register("greet", func(ctx context.Context, req invoker.Request) (invoker.Response, error) {
+		return invoker.Response{Output: fmt.Sprintf("hello %s from %s", strings.Join(req.Args, " "), req.Slack.UserName)}, nil
+	})
+	suite.handler = New(funcInvoker, suite.handler.HTTPClient, suite.handler.logger, "greet", 1*time.Second, "testToken")
+
+	// create request
+	form := make(url.Values)
+	form.Add("token", "testToken")
+	form.Add("text", "hatsune miku")
+	form.Add("user_name", "rin")
+	form.Add("response_url", "https://dummy")
+
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", echo.MIMEApplicationForm)
+
+	e := echo.New()
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+
+	// invoke handler
+	err := suite.handler.Handler()(c)
+	// wait for the command to finish
+	time.Sleep(100 * time.Millisecond)
+
+	// assert
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), http.StatusOK, rec.Code)
+	assert.Len(suite.T(), suite.monitor.body, 2)
+	assert.Contains(suite.T(), suite.monitor.body[1], "hello hatsune miku from rin")
+}
+
+func (suite *HandlerTestSuite) TestHandlerArgumentModeStdin() {
+	// mock invoker
+	hasStdin := mock.MatchedBy(func(ctx context.Context) bool {
+		stdin, ok := invoker.StdinFrom(ctx)
+		return ok && stdin == "don't forget"
+	})
+	suite.invoker.On("Invoke", hasStdin, "/usr/bin/echo").Return(0, "noted", nil)
+	suite.handler.ArgumentMode = ArgumentModeStdin
+
+	// create request
+	form := make(url.Values)
+	form.Add("token", "testToken")
+	form.Add("text", "don't forget")
+	form.Add("response_url", "https://dummy")
+
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", echo.MIMEApplicationForm)
+
+	e := echo.New()
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+
+	// invoke handler
+	err := suite.handler.Handler()(c)
+	// wait for the command to finish
+	time.Sleep(100 * time.Millisecond)
+
+	// assert
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), http.StatusOK, rec.Code)
+	assert.Len(suite.T(), suite.monitor.body, 2)
+	assert.Contains(suite.T(), suite.monitor.body[1], "noted")
+	suite.invoker.AssertExpectations(suite.T())
+}
+
+func (suite *HandlerTestSuite) TestHandlerSchema() {
+	// mock invoker
+	suite.invoker.On("Invoke", mock.Anything, "/usr/bin/echo", "--tag=v1", "--wait=5m", "api", "staging").Return(0, "deployed", nil)
+	suite.handler.Schema = deploySchema
+
+	// create request
+	form := make(url.Values)
+	form.Add("token", "testToken")
+	form.Add("text", "api --tag=v1")
+	form.Add("response_url", "https://dummy")
+
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", echo.MIMEApplicationForm)
+
+	e := echo.New()
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+
+	// invoke handler
+	err := suite.handler.Handler()(c)
+	// wait for the command to finish
+	time.Sleep(100 * time.Millisecond)
+
+	// assert
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), http.StatusOK, rec.Code)
+	assert.Len(suite.T(), suite.monitor.body, 2)
+	assert.Contains(suite.T(), suite.monitor.body[1], "deployed")
+	suite.invoker.AssertExpectations(suite.T())
+}
+
+func (suite *HandlerTestSuite) TestHandlerArgvTemplate() {
+	// mock invoker
+	suite.invoker.On("Invoke", mock.Anything, "/usr/bin/echo", "--env", "prod", "--service", "api; rm -rf /", "--requested-by", "miku").Return(0, "deployed", nil)
+	suite.handler.ArgvTemplate, _ = ParseArgvTemplate([]string{"--env", "{{.Arg 1}}", "--service", "{{.Arg 0}}", "--requested-by", "{{.UserName}}"})
+
+	// create request
+	form := make(url.Values)
+	form.Add("token", "testToken")
+	form.Add("text", `"api; rm -rf /" prod`)
+	form.Add("user_name", "miku")
+	form.Add("response_url", "https://dummy")
+
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", echo.MIMEApplicationForm)
+
+	e := echo.New()
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+
+	// invoke handler
+	err := suite.handler.Handler()(c)
+	// wait for the command to finish
+	time.Sleep(100 * time.Millisecond)
+
+	// assert
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), http.StatusOK, rec.Code)
+	assert.Len(suite.T(), suite.monitor.body, 2)
+	suite.invoker.AssertExpectations(suite.T())
+}
+
+func (suite *HandlerTestSuite) TestHandlerTextFormat() {
+	// mock invoker
+	suite.invoker.On("Invoke", mock.Anything, "/usr/bin/echo", "notify", "U123", "general", "a & b").Return(0, "notified", nil)
+	suite.handler.TextFormat = TextFormat{Users: ReferenceFormatID, Channels: ReferenceFormatName}
+
+	// create request
+	form := make(url.Values)
+	form.Add("token", "testToken")
+	form.Add("text", `notify <@U123|alice> <#C123|general> "a &amp; b"`)
+	form.Add("response_url", "https://dummy")
+
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", echo.MIMEApplicationForm)
+
+	e := echo.New()
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+
+	// invoke handler
+	err := suite.handler.Handler()(c)
+	// wait for the command to finish
+	time.Sleep(100 * time.Millisecond)
+
+	// assert
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), http.StatusOK, rec.Code)
+	assert.Len(suite.T(), suite.monitor.body, 2)
+	suite.invoker.AssertExpectations(suite.T())
+}
+
+func (suite *HandlerTestSuite) TestHandlerPublic() {
+	// mock invoker
+	suite.invoker.On("Invoke", mock.Anything, "/usr/bin/echo", "hatsune", "miku").Return(0, "hatsune miku", nil)
+	suite.handler.PublicFlag = "--public"
+	suite.handler.DeleteOriginal = true
+
+	// create request
+	form := make(url.Values)
+	form.Add("token", "testToken")
+	form.Add("text", "hatsune miku --public")
+	form.Add("response_url", "https://dummy")
+
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", echo.MIMEApplicationForm)
+
+	e := echo.New()
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+
+	// invoke handler
+	err := suite.handler.Handler()(c)
+	// wait for the command to finish
+	time.Sleep(100 * time.Millisecond)
+
+	// assert the start notice is ephemeral, and deleted before the result is posted in the channel
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), http.StatusOK, rec.Code)
+	assert.Len(suite.T(), suite.monitor.body, 3)
+	assert.Contains(suite.T(), suite.monitor.body[0], `"response_type":"ephemeral"`)
+	assert.Contains(suite.T(), suite.monitor.body[1], `"delete_original":true`)
+	assert.Contains(suite.T(), suite.monitor.body[2], `"response_type":"in_channel"`)
+	assert.Contains(suite.T(), suite.monitor.body[2], "hatsune miku")
+	suite.invoker.AssertExpectations(suite.T())
+}
+
+func (suite *HandlerTestSuite) TestHandlerSuppressStart() {
+	// mock invoker
+	suite.invoker.On("Invoke", mock.Anything, "/usr/bin/echo", "hatsune", "miku").Return(0, "hatsune miku", nil)
+	suite.handler.SuppressStart = true
+
+	// create request
+	form := make(url.Values)
+	form.Add("token", "testToken")
+	form.Add("text", "hatsune miku")
+	form.Add("response_url", "https://dummy")
+
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", echo.MIMEApplicationForm)
+
+	e := echo.New()
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+
+	// invoke handler
+	err := suite.handler.Handler()(c)
+	// wait for the command to finish
+	time.Sleep(100 * time.Millisecond)
+
+	// assert only the result is posted
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), http.StatusOK, rec.Code)
+	assert.Len(suite.T(), suite.monitor.body, 1)
+	assert.Contains(suite.T(), suite.monitor.body[0], "hatsune miku")
+}
+
+func (suite *HandlerTestSuite) TestHandlerSync() {
+	// mock invoker
+	suite.invoker.On("Invoke", mock.Anything, "/usr/bin/echo", "hatsune", "miku").Return(0, "hatsune miku", nil)
+	suite.handler.SyncBudget = 500 * time.Millisecond
+
+	// create request
+	form := make(url.Values)
+	form.Add("token", "testToken")
+	form.Add("text", "hatsune miku")
+	form.Add("response_url", "https://dummy")
+
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", echo.MIMEApplicationForm)
+
+	e := echo.New()
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+
+	// invoke handler
+	err := suite.handler.Handler()(c)
+	// wait for the command to finish
+	time.Sleep(100 * time.Millisecond)
+
+	// assert the result is in the response without the notifications
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), http.StatusOK, rec.Code)
+	assert.Contains(suite.T(), rec.Body.String(), "hatsune miku")
+	assert.Len(suite.T(), suite.monitor.body, 0)
+}
+
+func (suite *HandlerTestSuite) TestHandlerSyncFallback() {
+	// mock invoker
+	suite.invoker.On("Invoke", mock.Anything, "/usr/bin/echo", "hatsune", "miku").After(200*time.Millisecond).Return(0, "hatsune miku", nil)
+	suite.handler.SyncBudget = 50 * time.Millisecond
+
+	// create request
+	form := make(url.Values)
+	form.Add("token", "testToken")
+	form.Add("text", "hatsune miku")
+	form.Add("response_url", "https://dummy")
+
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", echo.MIMEApplicationForm)
+
+	e := echo.New()
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+
+	// invoke handler
+	err := suite.handler.Handler()(c)
+	// wait for the command to finish
+	time.Sleep(300 * time.Millisecond)
+
+	// assert the result is posted to the response URL
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), http.StatusOK, rec.Code)
+	assert.Empty(suite.T(), rec.Body.String())
+	assert.Len(suite.T(), suite.monitor.body, 2)
+	assert.Contains(suite.T(), suite.monitor.body[0], "Invoke Command with 1s timeout")
+	assert.Contains(suite.T(), suite.monitor.body[1], "hatsune miku")
+}
+
+func (suite *HandlerTestSuite) TestHandlerSchemaHelp() {
+	suite.handler.Schema = deploySchema
+
+	// create request
+	form := make(url.Values)
+	form.Add("token", "testToken")
+	form.Add("command", "/deploy")
+	form.Add("text", "help")
+	form.Add("response_url", "https://dummy")
+
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", echo.MIMEApplicationForm)
+
+	e := echo.New()
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+
+	// invoke handler
+	err := suite.handler.Handler()(c)
+	// wait for the command to finish
+	time.Sleep(100 * time.Millisecond)
+
+	// assert
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), http.StatusOK, rec.Code)
+	var msg slack.Msg
+	assert.NoError(suite.T(), json.Unmarshal(rec.Body.Bytes(), &msg))
+	assert.Contains(suite.T(), msg.Text, "Usage: /deploy [flags] &lt;api|web&gt; [env] [replicas]")
+	assert.Equal(suite.T(), slack.ResponseTypeEphemeral, msg.ResponseType)
+	assert.Len(suite.T(), suite.monitor.body, 0)
+	suite.invoker.AssertNotCalled(suite.T(), "Invoke")
+}
+
+func (suite *HandlerTestSuite) TestHandlerFailSchema() {
+	suite.handler.Schema = deploySchema
+
+	// create request
+	form := make(url.Values)
+	form.Add("token", "testToken")
+	form.Add("command", "/deploy")
+	form.Add("text", "db --tag=v1")
+	form.Add("response_url", "https://dummy")
+
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", echo.MIMEApplicationForm)
+
+	e := echo.New()
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+
+	// invoke handler
+	err := suite.handler.Handler()(c)
+	// wait for the command to finish
+	time.Sleep(100 * time.Millisecond)
+
+	// assert
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), http.StatusOK, rec.Code)
+	assert.Contains(suite.T(), rec.Body.String(), `service must be one of api, web`)
+	assert.Contains(suite.T(), rec.Body.String(), "Usage: /deploy")
+	assert.Len(suite.T(), suite.monitor.body, 0)
+	suite.invoker.AssertNotCalled(suite.T(), "Invoke")
+}
+
 func (suite *HandlerTestSuite) TestHandlerFailInvalidToken() {
 	// create request
 	form := make(url.Values)
@@ -142,6 +532,38 @@ func (suite *HandlerTestSuite) TestHandlerFailCommon() {
 	assert.Contains(suite.T(), suite.monitor.body[1], "unexpected error")
 }
 
+func (suite *HandlerTestSuite) TestHandlerFailLimitExceeded() {
+	// mock invoker
+	limitErr := &invoker.LimitExceededError{Resource: "CPU time", Err: errors.New("signal: CPU time limit exceeded")}
+	suite.invoker.On("Invoke", mock.Anything, "/usr/bin/echo", "hatsune", "miku").Return(-1, "partial output", limitErr)
+
+	// create request
+	form := make(url.Values)
+	form.Add("token", "testToken")
+	form.Add("text", "hatsune miku")
+	form.Add("response_url", "https://dummy")
+
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", echo.MIMEApplicationForm)
+
+	e := echo.New()
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+
+	// invoke handler
+	err := suite.handler.Handler()(c)
+	// wait for the command to finish
+	time.Sleep(100 * time.Millisecond)
+
+	// assert
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), http.StatusOK, rec.Code)
+	assert.Len(suite.T(), suite.monitor.body, 2)
+	assert.Contains(suite.T(), suite.monitor.body[1], "partial output")
+	assert.Contains(suite.T(), suite.monitor.body[1], "Command exceeded the CPU time limit")
+	assert.Contains(suite.T(), suite.monitor.body[1], "Exit code: -1")
+}
+
 func (suite *HandlerTestSuite) TestMalformedArguments() {
 	// create request
 	form := make(url.Values)
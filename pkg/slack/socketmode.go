@@ -0,0 +1,211 @@
+package slack
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"github.com/sirupsen/logrus"
+	"github.com/slack-go/slack"
+	"github.com/slack-go/slack/slackevents"
+	"github.com/slack-go/slack/socketmode"
+)
+
+const (
+	// socketCommandPath is the internal path of the slash commands received by Socket Mode
+	socketCommandPath = "/command"
+	// socketInteractionPath is the internal path of the interactions received by Socket Mode
+	socketInteractionPath = "/interaction"
+	// socketOptionsPath is the internal path of the block suggestions received by Socket Mode
+	socketOptionsPath = "/options"
+)
+
+// SocketMode is the transport receiving the slash commands, the interactions and the events through the Socket Mode websocket
+// instead of the public HTTP endpoints. The requests are acknowledged with the responses of the same handlers as
+// the HTTP requests.
+type SocketMode struct {
+	// AppToken is the app-level token (xapp-) opening the Socket Mode connection
+	AppToken string
+	// Slash is the slash command handler
+	Slash *Handler
+	// Interactions is the handler of the interactions, nil means the interactions are ignored
+	Interactions *InteractionHandler
+	// Options is the handler of the block suggestions, nil means the suggestions are ignored
+	Options *OptionsHandler
+	// Events is the handler of the app mentions and the direct messages, nil means the events are ignored
+	Events *EventsHandler
+
+	// logger is the logger used to log the events
+	logger *logrus.Logger
+}
+
+// NewSocketMode returns a new SocketMode of the slash command handler
+func NewSocketMode(appToken string, slash *Handler, logger *logrus.Logger) *SocketMode {
+	return &SocketMode{
+		AppToken: appToken,
+		Slash:    slash,
+
+		logger: logger,
+	}
+}
+
+// Run connects to slack and handles the requests until the context is done. The connection is reopened by the
+// client when slack asks, it returns the error only when the connection can not be reopened.
+func (s *SocketMode) Run(ctx context.Context) error {
+	options := []slack.Option{slack.OptionAppLevelToken(s.AppToken), slack.OptionHTTPClient(s.Slash.HTTPClient)}
+	if s.Slash.APIURL != "" {
+		options = append(options, slack.OptionAPIURL(s.Slash.APIURL))
+	}
+	client := socketmode.New(slack.New(s.Slash.BotToken, options...))
+
+	// the requests are handled by the handlers as the HTTP requests
+	e := echo.New()
+	e.POST(socketCommandPath, s.Slash.Handler())
+	if s.Interactions != nil {
+		e.POST(socketInteractionPath, s.Interactions.Handler())
+	}
+	if s.Options != nil {
+		e.POST(socketOptionsPath, s.Options.Handler())
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	errs := make(chan error, 1)
+	go func() {
+		errs <- client.RunContext(ctx)
+	}()
+
+	for {
+		select {
+		case err := <-errs:
+			if errors.Is(err, context.Canceled) && ctx.Err() != nil {
+				return nil
+			}
+			return err
+		case evt := <-client.Events:
+			s.handleEvent(ctx, client, e, evt)
+		}
+	}
+}
+
+// handleEvent handles the event of the client, the requests are dispatched in background so the following requests
+// are not blocked
+func (s *SocketMode) handleEvent(ctx context.Context, client *socketmode.Client, e *echo.Echo, evt socketmode.Event) {
+	switch evt.Type {
+	case socketmode.EventTypeConnecting:
+		s.logger.Info("Connecting to slack by Socket Mode")
+	case socketmode.EventTypeConnected:
+		s.logger.Info("Connected to slack by Socket Mode")
+	case socketmode.EventTypeConnectionError, socketmode.EventTypeIncomingError, socketmode.EventTypeErrorWriteFailed, socketmode.EventTypeErrorBadMessage:
+		s.logger.WithField("event", evt.Type).WithField("data", evt.Data).Warn("Socket Mode error")
+	case socketmode.EventTypeInvalidAuth:
+		s.logger.Error("Invalid app-level token")
+	case socketmode.EventTypeSlashCommand:
+		go s.dispatch(ctx, client, e, evt.Request, socketCommandPath, commandForm)
+	case socketmode.EventTypeInteractive:
+		path := socketInteractionPath
+		if callback, ok := evt.Data.(slack.InteractionCallback); ok && callback.Type == slack.InteractionTypeBlockSuggestion {
+			path = socketOptionsPath
+		}
+		go s.dispatch(ctx, client, e, evt.Request, path, interactionForm)
+	case socketmode.EventTypeEventsAPI:
+		// the events are authenticated by the connection instead of the signature
+		client.Ack(*evt.Request)
+		event, ok := evt.Data.(slackevents.EventsAPIEvent)
+		if s.Events == nil || !ok {
+			s.logger.Info("Ignored the event")
+			return
+		}
+		s.Events.dispatch(event)
+	}
+}
+
+// dispatch posts the request to the handler of the path, and acknowledges it with the response
+func (s *SocketMode) dispatch(ctx context.Context, client *socketmode.Client, e *echo.Echo, request *socketmode.Request, path string, form func(json.RawMessage, string) (url.Values, error)) {
+	logger := s.logger.WithField("type", request.Type).WithField("envelope", request.EnvelopeID)
+
+	// the connection is authenticated by the app-level token, the requests are trusted as verified
+	values, err := form(request.Payload, s.Slash.VerificationToken)
+	if err != nil {
+		logger.WithError(err).Error("Failed to parse the request")
+		client.Ack(*request)
+		return
+	}
+
+	req, err := http.NewRequestWithContext(context.WithValue(ctx, verifiedKey{}, true), http.MethodPost, path, strings.NewReader(values.Encode()))
+	if err != nil {
+		logger.WithError(err).Error("Failed to create the request")
+		client.Ack(*request)
+		return
+	}
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationForm)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		logger.WithField("status", rec.Code).Warn("Rejected the request")
+		client.Ack(*request)
+		return
+	}
+	if body := rec.Body.Bytes(); json.Valid(body) {
+		client.Ack(*request, json.RawMessage(body))
+		return
+	}
+	client.Ack(*request)
+}
+
+// commandForm returns the form of the slash command from the payload
+func commandForm(payload json.RawMessage, token string) (url.Values, error) {
+	fields, err := payloadFields(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	values := make(url.Values)
+	for key, value := range fields {
+		if s, ok := value.(string); ok {
+			values.Set(key, s)
+		}
+	}
+	values.Set("token", token)
+
+	return values, nil
+}
+
+// interactionForm returns the form of the interaction from the payload
+func interactionForm(payload json.RawMessage, token string) (url.Values, error) {
+	fields, err := payloadFields(payload)
+	if err != nil {
+		return nil, err
+	}
+	fields["token"] = token
+
+	encoded, err := json.Marshal(fields)
+	if err != nil {
+		return nil, err
+	}
+
+	return url.Values{"payload": {string(encoded)}}, nil
+}
+
+// payloadFields returns the fields of the payload object, the numbers are kept as is
+func payloadFields(payload json.RawMessage) (map[string]interface{}, error) {
+	var fields map[string]interface{}
+	decoder := json.NewDecoder(bytes.NewReader(payload))
+	decoder.UseNumber()
+	if err := decoder.Decode(&fields); err != nil {
+		return nil, err
+	}
+	if fields == nil {
+		return nil, fmt.Errorf("malformed payload: %s", payload)
+	}
+
+	return fields, nil
+}
@@ -0,0 +1,176 @@
+package slack
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/HatsuneMiku3939/slashes/pkg/invoker"
+
+	"github.com/gorilla/websocket"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// socketStandIn is a local stand-in of the Socket Mode endpoints, which opens a websocket of the app-level token
+type socketStandIn struct {
+	*httptest.Server
+
+	// conns is the opened websockets
+	conns chan *websocket.Conn
+}
+
+// socketAck is the acknowledgement of a Socket Mode request
+type socketAck struct {
+	EnvelopeID string          `json:"envelope_id"`
+	Payload    json.RawMessage `json:"payload"`
+}
+
+// newSocketStandIn starts a Socket Mode stand-in, which is closed at the end of the test
+func newSocketStandIn(t *testing.T) *socketStandIn {
+	s := &socketStandIn{conns: make(chan *websocket.Conn, 1)}
+	// the client sends the origin of slack
+	upgrader := websocket.Upgrader{CheckOrigin: func(r *http.Request) bool { return r.Header.Get("Origin") == "https://api.slack.com" }}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/apps.connections.open":
+			w.Header().Set("Content-Type", "application/json")
+			if r.Header.Get("Authorization") != "Bearer xapp-test" {
+				_ = json.NewEncoder(w).Encode(map[string]interface{}{"ok": false, "error": "invalid_auth"})
+				return
+			}
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{"ok": true, "url": "ws" + strings.TrimPrefix(s.URL, "http") + "/link"})
+		case "/link":
+			conn, err := upgrader.Upgrade(w, r, nil)
+			if err != nil {
+				return
+			}
+			_ = conn.WriteJSON(map[string]interface{}{"type": "hello", "num_connections": 1})
+			s.conns <- conn
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(s.Close)
+
+	return s
+}
+
+// request sends the Socket Mode request of the payload, and returns the acknowledgement
+func request(t *testing.T, conn *websocket.Conn, envelopeID string, requestType string, payload map[string]interface{}) socketAck {
+	require.NoError(t, conn.WriteJSON(map[string]interface{}{
+		"envelope_id":              envelopeID,
+		"type":                     requestType,
+		"payload":                  payload,
+		"accepts_response_payload": true,
+	}))
+
+	var ack socketAck
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(3*time.Second)))
+	require.NoError(t, conn.ReadJSON(&ack))
+	assert.Equal(t, envelopeID, ack.EnvelopeID)
+
+	return ack
+}
+
+// TestSocketMode tests handling the slash commands, the interactions and the block suggestions by Socket Mode
+func TestSocketMode(t *testing.T) {
+	standIn := newSocketStandIn(t)
+	recorder := newResponseRecorder(t)
+	envs := filepath.Join(t.TempDir(), "envs")
+	require.NoError(t, os.WriteFile(envs, []byte("staging\nprod\n"), 0600))
+
+	funcInvoker := invoker.NewFuncInvoker()
+	funcInvoker.Register("deploy", func(ctx context.Context, req invoker.Request) (invoker.Response, error) {
+		return invoker.Response{Output: "deployed " + strings.Join(req.Args, " ")}, nil
+	})
+	logger := logrus.New()
+	logger.SetLevel(logrus.PanicLevel)
+	slash := New(funcInvoker, http.DefaultClient, logger, "deploy", time.Second, "testToken")
+	slash.APIURL = standIn.URL + "/"
+	slash.SyncBudget = time.Second
+	slash.Retry = RetryPolicy{MaxAttempts: 1}
+	slash.Schema = &Schema{Args: []Parameter{{Name: "service"}}, Flags: []Parameter{{Name: "env", Options: &OptionSource{File: envs}}}}
+	socket := NewSocketMode("xapp-test", slash, logger)
+	socket.Interactions = NewInteractionHandler(slash, logger)
+	socket.Options = NewOptionsHandler(slash, logger)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	errs := make(chan error, 1)
+	go func() {
+		errs <- socket.Run(ctx)
+	}()
+	var conn *websocket.Conn
+	select {
+	case conn = <-standIn.conns:
+	case <-time.After(3 * time.Second):
+		t.Fatal("Socket Mode did not connect")
+	}
+	defer conn.Close()
+
+	// the slash command is answered in the acknowledgement within the sync budget, the payload token is not required
+	ack := request(t, conn, "e1", "slash_commands", map[string]interface{}{
+		"command": "/deploy", "text": "api", "user_id": "U1", "channel_id": "C1", "response_url": recorder.URL,
+	})
+	assert.Contains(t, string(ack.Payload), "deployed api")
+
+	// the interaction is acknowledged, and replied to the response URL
+	ack = request(t, conn, "e2", "interactive", blockAction("U1", recorder.URL, ActionRerun, "unknown"))
+	assert.Empty(t, ack.Payload)
+	messages := waitMessages(t, recorder, 1)
+	assert.Contains(t, messages[0], "Job `unknown` is not found")
+
+	// the block suggestion is answered in the acknowledgement
+	ack = request(t, conn, "e3", "interactive", map[string]interface{}{
+		"type": "block_suggestion", "block_id": "flag_env", "action_id": "env", "value": "pro",
+	})
+	assert.JSONEq(t, `{"options":[{"text":{"type":"plain_text","text":"prod"},"value":"prod"}]}`, string(ack.Payload))
+
+	// the malformed arguments are answered with the usage message
+	ack = request(t, conn, "e4", "slash_commands", map[string]interface{}{"command": "/deploy", "text": "'api"})
+	assert.Contains(t, string(ack.Payload), "malformed argument")
+
+	cancel()
+	select {
+	case err := <-errs:
+		assert.NoError(t, err)
+	case <-time.After(3 * time.Second):
+		t.Fatal("Socket Mode did not stop")
+	}
+}
+
+// TestSocketModeInvalidAuth tests failing with the invalid app-level token
+func TestSocketModeInvalidAuth(t *testing.T) {
+	standIn := newSocketStandIn(t)
+	logger := logrus.New()
+	logger.SetLevel(logrus.PanicLevel)
+	slash := New(invoker.NewFuncInvoker(), http.DefaultClient, logger, "deploy", time.Second, "testToken")
+	slash.APIURL = standIn.URL + "/"
+
+	err := NewSocketMode("xapp-wrong", slash, logger).Run(context.Background())
+	assert.EqualError(t, err, "invalid_auth")
+}
+
+// TestSocketModeForm tests converting the payloads to the forms of the HTTP requests
+func TestSocketModeForm(t *testing.T) {
+	values, err := commandForm(json.RawMessage(`{"command":"/deploy","text":"api","token":"payload","is_enterprise_install":false}`), "testToken")
+	require.NoError(t, err)
+	assert.Equal(t, "/deploy", values.Get("command"))
+	assert.Equal(t, "testToken", values.Get("token"))
+
+	values, err = interactionForm(json.RawMessage(`{"type":"block_actions","message":{"ts":1700000000.000100}}`), "testToken")
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"type":"block_actions","token":"testToken","message":{"ts":1700000000.000100}}`, values.Get("payload"))
+	assert.Contains(t, values.Get("payload"), "1700000000.000100")
+
+	_, err = commandForm(json.RawMessage(`null`), "testToken")
+	assert.EqualError(t, err, "malformed payload: null")
+}
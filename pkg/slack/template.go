@@ -0,0 +1,116 @@
+package slack
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+
+	"github.com/HatsuneMiku3939/slashes/pkg/invoker"
+)
+
+// ArgvTemplate is the template of the command line, each element is a Go text/template
+// rendered into exactly one argument. The user text is never split into additional
+// arguments, whatever it contains.
+type ArgvTemplate []*template.Template
+
+// argvFuncs is the functions available in the argv template
+var argvFuncs = template.FuncMap{
+	"join": strings.Join,
+}
+
+// ParseArgvTemplate parses the elements of the argv template, for example
+// ["--env", "{{.Arg 0}}", "--requested-by", "{{.UserName}}"].
+func ParseArgvTemplate(elements []string) (ArgvTemplate, error) {
+	argvTemplate := make(ArgvTemplate, 0, len(elements))
+	for i, element := range elements {
+		t, err := template.New(fmt.Sprintf("argv[%d]", i)).Funcs(argvFuncs).Parse(element)
+		if err != nil {
+			return nil, err
+		}
+		argvTemplate = append(argvTemplate, t)
+	}
+
+	return argvTemplate, nil
+}
+
+// Execute renders the command line from the arguments and the slack context.
+func (t ArgvTemplate) Execute(args *Arguments, slackContext invoker.SlackContext) ([]string, error) {
+	data := &argvData{SlackContext: slackContext, arguments: args}
+
+	argv := make([]string, 0, len(t))
+	for _, element := range t {
+		var b strings.Builder
+		if err := element.Execute(&b, data); err != nil {
+			return nil, err
+		}
+		argv = append(argv, b.String())
+	}
+
+	return argv, nil
+}
+
+// argvData is the data of the argv template, which provides the fields of the slack context
+// such as .UserName and .ChannelName, and the methods to access the arguments
+type argvData struct {
+	invoker.SlackContext
+
+	arguments *Arguments
+}
+
+// Arg returns the i-th positional argument, empty string if not given.
+func (d *argvData) Arg(i int) string {
+	if i < 0 || i >= len(d.arguments.Args) {
+		return ""
+	}
+
+	return d.arguments.Args[i]
+}
+
+// Args returns all the positional arguments, to be used with range or join.
+func (d *argvData) Args() []string {
+	return d.arguments.Args
+}
+
+// Flag returns the value of the named flag, empty string if not given.
+func (d *argvData) Flag(name string) string {
+	return d.arguments.Flags[name]
+}
+
+// MessageTemplates is the templates of the messages for each event of a job, which are executed
+// with MessageData. The message of the event is rendered by the message format if its template is nil.
+type MessageTemplates struct {
+	// Start is the template of the start notice
+	Start *template.Template
+	// Finish is the template of the result of the command exited with any exit code
+	Finish *template.Template
+	// Error is the template of the result of the command failed to be invoked, canceled or killed
+	Error *template.Template
+	// Timeout is the template of the result of the command timed out
+	Timeout *template.Template
+}
+
+// messageFuncs is the functions available in the message templates
+var messageFuncs = template.FuncMap{
+	"escape": escapeText,
+	"code": func(text string) string {
+		return codeBlock(strings.TrimSpace(text), maxSectionLength)
+	},
+}
+
+// ParseMessageTemplate parses the template of a message, which is executed with MessageData
+// (e.g. "{{.UserName}} deployed in {{.Duration}}\n{{code .Output}}").
+func ParseMessageTemplate(name string, text string) (*template.Template, error) {
+	return template.New(name).Funcs(messageFuncs).Parse(text)
+}
+
+// result returns the template of the result by the outcome, nil if not set
+func (t *MessageTemplates) result(outcome Outcome) *template.Template {
+	switch outcome {
+	case OutcomeTimeout:
+		return t.Timeout
+	case OutcomeError:
+		return t.Error
+	default:
+		return t.Finish
+	}
+}
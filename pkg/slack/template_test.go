@@ -0,0 +1,85 @@
+package slack
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/HatsuneMiku3939/slashes/pkg/invoker"
+
+	"github.com/sirupsen/logrus"
+	"github.com/slack-go/slack"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestArgvTemplate tests building the command line by the template
+func TestArgvTemplate(t *testing.T) {
+	argvTemplate, err := ParseArgvTemplate([]string{
+		"deploy",
+		"--env={{.Arg 1}}",
+		"{{.Arg 0}}",
+		"--wait",
+		"{{.Flag \"wait\"}}",
+		"--requested-by",
+		"{{.UserName}}@{{.ChannelName}}",
+		"{{join .Args \",\"}}",
+		"{{.Arg 5}}",
+	})
+	assert.NoError(t, err)
+
+	args := &Arguments{Args: []string{"api; rm -rf /", "prod --force"}, Flags: map[string]string{"wait": "5m"}}
+	argv, err := argvTemplate.Execute(args, invoker.SlackContext{UserName: "miku", ChannelName: "general"})
+
+	// assert the user text is never split into additional arguments
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"deploy",
+		"--env=prod --force",
+		"api; rm -rf /",
+		"--wait",
+		"5m",
+		"--requested-by",
+		"miku@general",
+		"api; rm -rf /,prod --force",
+		"",
+	}, argv)
+}
+
+// TestParseArgvTemplateFailure tests the failure case of parsing a malformed template
+func TestParseArgvTemplateFailure(t *testing.T) {
+	_, err := ParseArgvTemplate([]string{"{{.Arg 0}"})
+	assert.Error(t, err)
+
+	argvTemplate, err := ParseArgvTemplate([]string{"{{.Unknown}}"})
+	assert.NoError(t, err)
+	_, err = argvTemplate.Execute(&Arguments{}, invoker.SlackContext{})
+	assert.Error(t, err)
+}
+
+// TestMessageTemplates tests rendering the messages by the templates of the events
+func TestMessageTemplates(t *testing.T) {
+	start, err := ParseMessageTemplate("start", "{{.UserName}} started {{.Command}} {{.Text}} ({{.JobID}}, {{.Timeout}})")
+	assert.NoError(t, err)
+	finish, err := ParseMessageTemplate("finish", "{{.Outcome}} with {{.ExitCode}} in {{.Duration}}\n{{code .Output}}")
+	assert.NoError(t, err)
+	timeout, err := ParseMessageTemplate("timeout", "{{.Error}}: {{escape .Output}}")
+	assert.NoError(t, err)
+
+	h := &Handler{Templates: MessageTemplates{Start: start, Finish: finish, Timeout: timeout}, Timeout: 5 * time.Second, logger: logrus.New()}
+	j := &job{id: "0123456789abcdef", cmd: slack.SlashCommand{Command: "/deploy", Text: "api", UserName: "miku"}}
+
+	// assert
+	assert.Equal(t, "miku started /deploy api (0123456789abcdef, 5s)", h.startMessage(j).Text)
+	assert.Equal(t, "failure with 2 in 1.5s\n```\nno &lt;service&gt;\n```", h.finishMessage(j, &result{exitCode: 2, output: "no <service>\n", err: errors.New("exit status 2"), duration: 1500 * time.Millisecond}).Text)
+	assert.Equal(t, "Command timed out: &lt;partial&gt;", h.finishMessage(j, &result{exitCode: -1, output: "<partial>", err: errors.New("signal: killed"), timedOut: true}).Text)
+
+	// rendered by the message format without the template of the event
+	assert.Equal(t, "```\ncommand not found\n\ncommand not found\nExit code: -1\n```", h.finishMessage(j, &result{exitCode: -1, output: "command not found", err: errors.New("command not found")}).Text)
+
+	// rendered by the message format if the template fails
+	broken, err := ParseMessageTemplate("finish", "{{.Unknown}}")
+	assert.NoError(t, err)
+	h.Templates.Finish = broken
+	h.logger.SetLevel(logrus.PanicLevel)
+	assert.Equal(t, "```\ndeployed\n```", h.finishMessage(j, &result{exitCode: 0, output: "deployed"}).Text)
+}
@@ -0,0 +1,218 @@
+package slack
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/slack-go/slack"
+)
+
+// useWebAPI returns whether the messages of the jobs are posted by the Web API
+func (h *Handler) useWebAPI() bool {
+	return h.BotToken != ""
+}
+
+// webAPI returns the client of the slack Web API authorized by the bot token
+func (h *Handler) webAPI() *slack.Client {
+	options := []slack.Option{slack.OptionHTTPClient(h.HTTPClient)}
+	if h.APIURL != "" {
+		options = append(options, slack.OptionAPIURL(h.APIURL))
+	}
+
+	return slack.New(h.BotToken, options...)
+}
+
+// notify posts the message of the job. With the bot token, the message in the channel is posted by chat.postMessage
+// at first and the following messages update it in place by chat.update, and so are the messages of the job without
+// the response URL. The ephemeral messages are sent to the response URL to keep them private, except the start
+// notice updating the message of the job already posted in the channel such as the approval request. It falls back
+// to the response URL if the Web API fails.
+func (h *Handler) notify(ctx context.Context, j *job, msg *slack.Msg, final bool) error {
+	if h.postsWebAPI(j, msg, final) {
+		err := h.notifyWebAPI(ctx, j, msg)
+		if err == nil {
+			return nil
+		}
+		h.logger.WithError(err).WithField("job", j.id).Warn("Failed to post the message by the Web API, fall back to the response URL")
+	}
+
+	return h.respond(ctx, j, msg, final)
+}
+
+// postsWebAPI returns whether the message of the job is posted by the Web API
+func (h *Handler) postsWebAPI(j *job, msg *slack.Msg, final bool) bool {
+	if !h.useWebAPI() {
+		return false
+	}
+
+	return msg.ResponseType == slack.ResponseTypeInChannel || j.cmd.ResponseURL == "" || (!final && j.ts != "")
+}
+
+// respond posts the message to the response URL of the job within its limits. The intermediate messages are
+// skipped to keep a use for the result, and the result is posted by the Web API instead if the response URL is
+// expired or used up, to the user by DM or to the channel by the response type.
+func (h *Handler) respond(ctx context.Context, j *job, msg *slack.Msg, final bool) error {
+	reserved := 1
+	if final {
+		reserved = 0
+	}
+	if j.canRespond(reserved) {
+		j.responseURLUses++
+		return h.postMessage(ctx, j.cmd.ResponseURL, msg)
+	}
+
+	logger := h.logger.WithField("job", j.id).WithField("uses", j.responseURLUses).WithField("age", time.Since(j.startedAt).Round(time.Second))
+	if !final {
+		logger.Info("Skipped the intermediate message, the response URL is expired or used up")
+		return nil
+	}
+	if !h.useWebAPI() {
+		return errors.New("the response URL is expired or used up, and no bot token to post the result by the Web API")
+	}
+
+	channel, options := j.cmd.UserID, msgOptions(msg)
+	switch {
+	case j.threadTS != "":
+		channel, options = j.cmd.ChannelID, append(options, slack.MsgOptionTS(j.threadTS))
+	case msg.ResponseType == slack.ResponseTypeInChannel:
+		channel = j.cmd.ChannelID
+	}
+	logger.WithField("channel", channel).Info("The response URL is expired or used up, post the result by the Web API")
+	_, _, err := h.postWebAPI(ctx, channel, options...)
+	return err
+}
+
+// notifyWebAPI posts the message of the job by chat.postMessage, or updates the message already posted by chat.update.
+// The message of the job triggered by a message is posted in its thread.
+func (h *Handler) notifyWebAPI(ctx context.Context, j *job, msg *slack.Msg) error {
+	if j.ts == "" {
+		options := msgOptions(msg)
+		if j.threadTS != "" {
+			options = append(options, slack.MsgOptionTS(j.threadTS))
+		}
+		channel, ts, err := h.postWebAPI(ctx, j.cmd.ChannelID, options...)
+		if err != nil {
+			return err
+		}
+		j.channel, j.ts = channel, ts
+		return nil
+	}
+
+	return h.retry(ctx, func() error {
+		if _, _, _, err := h.webAPI().UpdateMessageContext(ctx, j.channel, j.ts, msgOptions(msg)...); err != nil {
+			return fmt.Errorf("chat.update: %w", err)
+		}
+		return nil
+	})
+}
+
+// postWebAPI posts the message to the channel by chat.postMessage retrying the transient failures,
+// and returns the channel and the timestamp of the message
+func (h *Handler) postWebAPI(ctx context.Context, channel string, options ...slack.MsgOption) (string, string, error) {
+	var posted, ts string
+	err := h.retry(ctx, func() error {
+		var err error
+		if posted, ts, err = h.webAPI().PostMessageContext(ctx, channel, options...); err != nil {
+			return fmt.Errorf("chat.postMessage: %w", err)
+		}
+		return nil
+	})
+
+	return posted, ts, err
+}
+
+// replyInThread posts the result as a reply in the thread of the message of the job, and marks the message finished
+func (h *Handler) replyInThread(ctx context.Context, j *job, r *result) error {
+	options := append(msgOptions(h.finishMessage(j, r)), slack.MsgOptionTS(j.ts))
+	if _, _, err := h.postWebAPI(ctx, j.channel, options...); err != nil {
+		return err
+	}
+	h.markFinished(ctx, j, r, ", see the result in the thread")
+
+	return nil
+}
+
+// markFinished updates the message of the job posted by the Web API with the outcome, the result is posted elsewhere
+func (h *Handler) markFinished(ctx context.Context, j *job, r *result, note string) {
+	emoji, _ := outcomeStyle(r.outcome())
+	status := fmt.Sprintf("%s Finished with %s in %s%s", emoji, r.outcome(), r.duration.Round(time.Millisecond), note)
+	if err := h.notifyWebAPI(ctx, j, h.annotatedStartMessage(j, status)); err != nil {
+		h.logger.WithError(err).WithField("job", j.id).Warn("Failed to mark the message finished")
+	}
+}
+
+// mirrorResult posts the result to the audit channels, the failures are logged. It has its own timeout, since the
+// retries of the result may have used up the timeout of the notification.
+func (h *Handler) mirrorResult(j *job, r *result) {
+	if len(h.AuditChannels) == 0 || !h.useWebAPI() {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), notifyTimeout)
+	defer cancel()
+
+	msg := h.renderFinish(j, r)
+	msg.Text = fmt.Sprintf("<@%s> ran `%s` in <#%s>\n%s",
+		j.cmd.UserID, escapeText(strings.TrimSpace(j.cmd.Command+" "+j.cmd.Text)), j.cmd.ChannelID, msg.Text)
+
+	for _, channel := range h.AuditChannels {
+		if _, _, err := h.postWebAPI(ctx, channel, msgOptions(msg)...); err != nil {
+			h.logger.WithError(err).WithField("job", j.id).WithField("channel", channel).Error("Failed to mirror the result to the audit channel")
+		}
+	}
+}
+
+// msgOptions returns the options of the Web API posting the message. The blocks and the attachments are always
+// sent to clear those of the previous message on update.
+func msgOptions(msg *slack.Msg) []slack.MsgOption {
+	return []slack.MsgOption{
+		slack.MsgOptionText(msg.Text, false),
+		slack.MsgOptionBlocks(append([]slack.Block{}, msg.Blocks.BlockSet...)...),
+		slack.MsgOptionAttachments(append([]slack.Attachment{}, msg.Attachments...)...),
+	}
+}
+
+// awaitResult waits the result of the command, updating the message of the job with the elapsed time every
+// progress interval. The progress is reported only if the message of the job was posted by the Web API.
+func (h *Handler) awaitResult(j *job, results <-chan *result) *result {
+	var progress <-chan time.Time
+	if h.ProgressInterval > 0 && j.ts != "" {
+		ticker := time.NewTicker(h.ProgressInterval)
+		defer ticker.Stop()
+		progress = ticker.C
+	}
+
+	for {
+		select {
+		case r := <-results:
+			return r
+		case <-progress:
+			ctx, cancel := context.WithTimeout(context.Background(), notifyTimeout)
+			if err := h.notifyWebAPI(ctx, j, h.progressMessage(j, time.Since(j.startedAt))); err != nil {
+				h.logger.WithError(err).WithField("job", j.id).Warn("Failed to update the progress")
+			}
+			cancel()
+		}
+	}
+}
+
+// progressMessage returns the start notice with the elapsed time of the running command
+func (h *Handler) progressMessage(j *job, elapsed time.Duration) *slack.Msg {
+	return h.annotatedStartMessage(j, fmt.Sprintf(":stopwatch: Running for %s", elapsed.Round(time.Second)))
+}
+
+// annotatedStartMessage returns the start notice with the status line below
+func (h *Handler) annotatedStartMessage(j *job, status string) *slack.Msg {
+	msg := h.startMessage(j)
+	if len(msg.Blocks.BlockSet) == 0 {
+		msg.Text = fmt.Sprintf("%s\n%s", msg.Text, status)
+		return msg
+	}
+	msg.Blocks.BlockSet = append(msg.Blocks.BlockSet,
+		slack.NewContextBlock("progress", slack.NewTextBlockObject(slack.MarkdownType, status, false, false)))
+
+	return msg
+}
@@ -0,0 +1,317 @@
+package slack
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/HatsuneMiku3939/slashes/pkg/invoker"
+
+	"github.com/sirupsen/logrus"
+	"github.com/slack-go/slack"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeSlackAPI is a local stand-in of the slack Web API which records the calls
+type fakeSlackAPI struct {
+	*httptest.Server
+
+	mu sync.Mutex
+	// calls is the method and the form of each call
+	calls []fakeSlackCall
+	// failures is the methods responding with an error
+	failures map[string]string
+}
+
+// fakeSlackCall is a call of the slack Web API
+type fakeSlackCall struct {
+	method string
+	form   url.Values
+	// body is the raw body, which is JSON for some methods such as views.open
+	body string
+}
+
+// newFakeSlackAPI starts a fake slack Web API, which is closed at the end of the test
+func newFakeSlackAPI(t *testing.T) *fakeSlackAPI {
+	api := &fakeSlackAPI{failures: map[string]string{}}
+	api.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		if err := r.ParseForm(); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		method := strings.TrimPrefix(r.URL.Path, "/")
+
+		api.mu.Lock()
+		api.calls = append(api.calls, fakeSlackCall{method: method, form: r.PostForm, body: string(body)})
+		failure := api.failures[method]
+		api.mu.Unlock()
+
+		w.Header().Set("Content-Type", "application/json")
+		if failure != "" {
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{"ok": false, "error": failure})
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"ok": true, "channel": r.PostForm.Get("channel"), "ts": "1700000000.000100"})
+	}))
+	t.Cleanup(api.Close)
+
+	return api
+}
+
+// URL returns the base URL of the fake slack Web API
+func (api *fakeSlackAPI) URL() string {
+	return api.Server.URL + "/"
+}
+
+// Calls returns the calls recorded so far
+func (api *fakeSlackAPI) Calls() []fakeSlackCall {
+	api.mu.Lock()
+	defer api.mu.Unlock()
+
+	return append([]fakeSlackCall{}, api.calls...)
+}
+
+// newWebAPIHandler returns a handler posting to the fake slack Web API, the response URL is monitored
+func newWebAPIHandler(api *fakeSlackAPI, inv invoker.Invoker) (*Handler, *monitorTripper) {
+	monitor := &monitorTripper{expectedMethod: http.MethodPost, expectedURL: "https://dummy"}
+	logger := logrus.New()
+	logger.SetLevel(logrus.PanicLevel)
+
+	httpClient := &http.Client{Transport: &apiTripper{api: api.Server.URL, fallback: monitor}}
+	h := New(inv, httpClient, logger, "deploy", time.Second, "testToken")
+	h.BotToken = "xoxb-test"
+	h.APIURL = api.URL()
+
+	return h, monitor
+}
+
+// apiTripper is a http.RoundTripper sending the requests of the Web API to the fake server, and the others to the fallback
+type apiTripper struct {
+	api      string
+	fallback http.RoundTripper
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *apiTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	if strings.HasPrefix(req.URL.String(), t.api) {
+		return http.DefaultTransport.RoundTrip(req)
+	}
+
+	return t.fallback.RoundTrip(req)
+}
+
+// TestNotifyWebAPI tests posting the start notice and updating it in place with the result
+func TestNotifyWebAPI(t *testing.T) {
+	api := newFakeSlackAPI(t)
+	funcInvoker := invoker.NewFuncInvoker()
+	h, monitor := newWebAPIHandler(api, funcInvoker)
+	h.StartResponseType, h.FinishResponseType = slack.ResponseTypeInChannel, slack.ResponseTypeInChannel
+	funcInvoker.Register("deploy", func(ctx context.Context, req invoker.Request) (invoker.Response, error) {
+		return invoker.Response{Output: "deployed " + strings.Join(req.Args, " ")}, nil
+	})
+
+	j := h.newJob(slack.SlashCommand{Command: "/deploy", Text: "api", ChannelID: "C123", ResponseURL: "https://dummy"})
+	h.handleCommand(j)
+
+	calls := api.Calls()
+	require.Len(t, calls, 2)
+	assert.Equal(t, "chat.postMessage", calls[0].method)
+	assert.Equal(t, "C123", calls[0].form.Get("channel"))
+	assert.Equal(t, "xoxb-test", calls[0].form.Get("token"))
+	assert.Contains(t, calls[0].form.Get("text"), "Invoke Command with 1s timeout")
+	assert.Equal(t, "chat.update", calls[1].method)
+	assert.Equal(t, "C123", calls[1].form.Get("channel"))
+	assert.Equal(t, "1700000000.000100", calls[1].form.Get("ts"))
+	assert.Contains(t, calls[1].form.Get("text"), "deployed api")
+	assert.Len(t, monitor.body, 0)
+}
+
+// TestNotifyWebAPIProgress tests updating the message with the elapsed time of the running command
+func TestNotifyWebAPIProgress(t *testing.T) {
+	api := newFakeSlackAPI(t)
+	funcInvoker := invoker.NewFuncInvoker()
+	h, _ := newWebAPIHandler(api, funcInvoker)
+	h.StartResponseType, h.FinishResponseType = slack.ResponseTypeInChannel, slack.ResponseTypeInChannel
+	h.ProgressInterval = 40 * time.Millisecond
+	funcInvoker.Register("deploy", func(ctx context.Context, req invoker.Request) (invoker.Response, error) {
+		time.Sleep(150 * time.Millisecond)
+		return invoker.Response{Output: "deployed"}, nil
+	})
+
+	j := h.newJob(slack.SlashCommand{Command: "/deploy", Text: "api", ChannelID: "C123", ResponseURL: "https://dummy"})
+	h.handleCommand(j)
+
+	calls := api.Calls()
+	require.Greater(t, len(calls), 2)
+	assert.Equal(t, "chat.postMessage", calls[0].method)
+	for _, call := range calls[1 : len(calls)-1] {
+		assert.Equal(t, "chat.update", call.method)
+		assert.Contains(t, call.form.Get("text"), "Running for")
+	}
+	assert.Equal(t, "chat.update", calls[len(calls)-1].method)
+	assert.Contains(t, calls[len(calls)-1].form.Get("text"), "deployed")
+}
+
+// TestNotifyWebAPIFallback tests falling back to the response URL when the Web API fails
+func TestNotifyWebAPIFallback(t *testing.T) {
+	api := newFakeSlackAPI(t)
+	api.failures["chat.postMessage"] = "channel_not_found"
+	funcInvoker := invoker.NewFuncInvoker()
+	h, monitor := newWebAPIHandler(api, funcInvoker)
+	h.StartResponseType, h.FinishResponseType = slack.ResponseTypeInChannel, slack.ResponseTypeInChannel
+	funcInvoker.Register("deploy", func(ctx context.Context, req invoker.Request) (invoker.Response, error) {
+		return invoker.Response{Output: "deployed"}, nil
+	})
+
+	j := h.newJob(slack.SlashCommand{Command: "/deploy", Text: "api", ChannelID: "C123", ResponseURL: "https://dummy"})
+	h.handleCommand(j)
+
+	// both messages are tried by the Web API first, and posted to the response URL
+	calls := api.Calls()
+	require.Len(t, calls, 2)
+	assert.Equal(t, "chat.postMessage", calls[0].method)
+	assert.Equal(t, "chat.postMessage", calls[1].method)
+	require.Len(t, monitor.body, 2)
+	assert.Contains(t, monitor.body[0], "Invoke Command with 1s timeout")
+	assert.Contains(t, monitor.body[1], "deployed")
+}
+
+// TestNotifyWebAPIEphemeral tests keeping the ephemeral messages private with the bot token
+func TestNotifyWebAPIEphemeral(t *testing.T) {
+	api := newFakeSlackAPI(t)
+	funcInvoker := invoker.NewFuncInvoker()
+	h, monitor := newWebAPIHandler(api, funcInvoker)
+	funcInvoker.Register("deploy", func(ctx context.Context, req invoker.Request) (invoker.Response, error) {
+		return invoker.Response{Output: "deployed"}, nil
+	})
+
+	// both messages are sent to the response URL
+	j := h.newJob(slack.SlashCommand{Command: "/deploy", Text: "api", ChannelID: "C123", ResponseURL: "https://dummy"})
+	h.handleCommand(j)
+	assert.Empty(t, api.Calls())
+	require.Len(t, monitor.body, 2)
+	assert.Contains(t, monitor.body[0], `"response_type":"ephemeral"`)
+	assert.Contains(t, monitor.body[1], "deployed")
+	assert.Contains(t, monitor.body[1], `"response_type":"ephemeral"`)
+
+	// the start notice in the channel only shows the outcome of the ephemeral result
+	h.StartResponseType = slack.ResponseTypeInChannel
+	j = h.newJob(slack.SlashCommand{Command: "/deploy", Text: "api", ChannelID: "C123", ResponseURL: "https://dummy"})
+	h.handleCommand(j)
+	calls := api.Calls()
+	require.Len(t, calls, 2)
+	assert.Equal(t, "chat.postMessage", calls[0].method)
+	assert.Equal(t, "chat.update", calls[1].method)
+	assert.Contains(t, calls[1].form.Get("text"), ":white_check_mark: Finished with success")
+	assert.NotContains(t, calls[1].form.Get("text"), "deployed")
+	require.Len(t, monitor.body, 3)
+	assert.Contains(t, monitor.body[2], "deployed")
+}
+
+// TestProgressMessage tests the progress of the start notice in each message format
+func TestProgressMessage(t *testing.T) {
+	h := &Handler{MessageFormat: MessageFormatCode, Timeout: time.Second, logger: logrus.New()}
+	j := &job{id: "0123456789abcdef", cmd: slack.SlashCommand{Command: "/deploy", Text: "api"}}
+
+	msg := h.progressMessage(j, 2400*time.Millisecond)
+	assert.True(t, strings.HasSuffix(msg.Text, "```\n:stopwatch: Running for 2s"))
+
+	h.MessageFormat = MessageFormatBlocks
+	msg = h.progressMessage(j, 2400*time.Millisecond)
+	last := msg.Blocks.BlockSet[len(msg.Blocks.BlockSet)-1].(*slack.ContextBlock)
+	assert.Equal(t, ":stopwatch: Running for 2s", last.ContextElements.Elements[0].(*slack.TextBlockObject).Text)
+}
+
+// TestNotifyWebAPIThread tests replying the result in the thread and mirroring it to the audit channels
+func TestNotifyWebAPIThread(t *testing.T) {
+	api := newFakeSlackAPI(t)
+	funcInvoker := invoker.NewFuncInvoker()
+	h, monitor := newWebAPIHandler(api, funcInvoker)
+	h.StartResponseType, h.FinishResponseType = slack.ResponseTypeInChannel, slack.ResponseTypeInChannel
+	h.ThreadResult = true
+	h.AuditChannels = []string{"CAUDIT"}
+	funcInvoker.Register("deploy", func(ctx context.Context, req invoker.Request) (invoker.Response, error) {
+		return invoker.Response{Output: "deployed"}, nil
+	})
+
+	j := h.newJob(slack.SlashCommand{Command: "/deploy", Text: "api", UserID: "U123", ChannelID: "C123", ResponseURL: "https://dummy"})
+	h.handleCommand(j)
+
+	calls := api.Calls()
+	require.Len(t, calls, 4)
+	assert.Equal(t, "chat.postMessage", calls[0].method)
+
+	// the result in the thread
+	assert.Equal(t, "chat.postMessage", calls[1].method)
+	assert.Equal(t, "C123", calls[1].form.Get("channel"))
+	assert.Equal(t, "1700000000.000100", calls[1].form.Get("thread_ts"))
+	assert.Contains(t, calls[1].form.Get("text"), "deployed")
+
+	// the parent marked finished
+	assert.Equal(t, "chat.update", calls[2].method)
+	assert.Contains(t, calls[2].form.Get("text"), ":white_check_mark: Finished with success")
+
+	// the mirror in the audit channel
+	assert.Equal(t, "chat.postMessage", calls[3].method)
+	assert.Equal(t, "CAUDIT", calls[3].form.Get("channel"))
+	assert.Empty(t, calls[3].form.Get("thread_ts"))
+	assert.Equal(t, "<@U123> ran `/deploy api` in <#C123>\n```\ndeployed\n```", calls[3].form.Get("text"))
+	assert.Len(t, monitor.body, 0)
+}
+
+// TestRespondLimits tests keeping the uses of the response URL for the result
+func TestRespondLimits(t *testing.T) {
+	monitor := &monitorTripper{expectedMethod: http.MethodPost, expectedURL: "https://dummy"}
+	logger := logrus.New()
+	logger.SetLevel(logrus.PanicLevel)
+	h := New(nil, &http.Client{Transport: monitor}, logger, "deploy", time.Second, "testToken")
+	j := h.newJob(slack.SlashCommand{Command: "/deploy", Text: "api", ResponseURL: "https://dummy"})
+
+	// the intermediate message is skipped on the last use
+	j.responseURLUses = responseURLMaxUses - 1
+	assert.NoError(t, h.respond(context.Background(), j, &slack.Msg{Text: "start"}, false))
+	assert.Len(t, monitor.body, 0)
+
+	assert.NoError(t, h.respond(context.Background(), j, &slack.Msg{Text: "result"}, true))
+	require.Len(t, monitor.body, 1)
+	assert.Contains(t, monitor.body[0], "result")
+	assert.Equal(t, responseURLMaxUses, j.responseURLUses)
+
+	// the result can not be delivered without the bot token
+	assert.Error(t, h.respond(context.Background(), j, &slack.Msg{Text: "result"}, true))
+	assert.Len(t, monitor.body, 1)
+}
+
+// TestRespondExpired tests posting the result by the Web API when the response URL is expired
+func TestRespondExpired(t *testing.T) {
+	api := newFakeSlackAPI(t)
+	h, monitor := newWebAPIHandler(api, nil)
+	j := h.newJob(slack.SlashCommand{Command: "/deploy", Text: "api", UserID: "U123", ChannelID: "C123", ResponseURL: "https://dummy"})
+	j.startedAt = time.Now().Add(-responseURLLifetime)
+
+	// the intermediate message is skipped
+	assert.NoError(t, h.respond(context.Background(), j, &slack.Msg{Text: "start"}, false))
+	assert.Len(t, api.Calls(), 0)
+
+	// the ephemeral result is sent to the user by DM
+	assert.NoError(t, h.respond(context.Background(), j, &slack.Msg{Text: "result", ResponseType: slack.ResponseTypeEphemeral}, true))
+	// the public result is posted in the channel
+	assert.NoError(t, h.respond(context.Background(), j, &slack.Msg{Text: "result", ResponseType: slack.ResponseTypeInChannel}, true))
+
+	calls := api.Calls()
+	require.Len(t, calls, 2)
+	assert.Equal(t, "U123", calls[0].form.Get("channel"))
+	assert.Equal(t, "C123", calls[1].form.Get("channel"))
+	assert.Len(t, monitor.body, 0)
+}